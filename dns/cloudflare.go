@@ -0,0 +1,147 @@
+package dns
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "github.com/cloudflare/cloudflare-go"
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/metrics"
+)
+
+type Cloudflare struct {
+    api  *cloudflare.API
+    zone string
+}
+
+// NewCloudflare creates a provider for Cloudflare DNS, options are applied to the API connection after the defaults
+func NewCloudflare(env env.Env, options ...cloudflare.Option) (*Cloudflare, error) {
+    api, err := newAPI(env, options)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Cloudflare{
+        api:  api,
+        zone: env.Cloudflare.Zone,
+    }, nil
+}
+
+// Delete the record for a name if it still points to an address
+func (c *Cloudflare) Delete(ctx context.Context, name string, ip string) error {
+    rc, records, err := c.records(ctx, name)
+    if err != nil {
+        return err
+    }
+
+    // Only remove records which haven't been pointed elsewhere since the server was created
+    for _, record := range records {
+        if strings.EqualFold(record.Name, name) && record.Content == ip {
+            err = c.api.DeleteDNSRecord(ctx, rc, record.ID)
+            if err != nil {
+                return fmt.Errorf("unable to remove dns record: %v", err)
+            }
+        }
+    }
+
+    return nil
+}
+
+// Get the address a name points to
+func (c *Cloudflare) Get(ctx context.Context, name string) (string, error) {
+    _, records, err := c.records(ctx, name)
+    if err != nil {
+        return "", err
+    }
+
+    for _, record := range records {
+        if strings.EqualFold(record.Name, name) {
+            return record.Content, nil
+        }
+    }
+
+    return "", notFound(name)
+}
+
+// Upsert creates the record for a name if it doesn't exist, otherwise points it at an address
+func (c *Cloudflare) Upsert(ctx context.Context, name string, ip string) error {
+    rc, records, err := c.records(ctx, name)
+    if err != nil {
+        return err
+    }
+
+    var recordID string
+    for _, record := range records {
+        if strings.EqualFold(record.Name, name) {
+            recordID = record.ID
+        }
+    }
+
+    proxied := false
+    if recordID == "" {
+        _, err = c.api.CreateDNSRecord(ctx, rc, cloudflare.CreateDNSRecordParams{Content: ip, Name: name, Proxied: &proxied, TTL: recordTTL, Type: "A"})
+    } else {
+        _, err = c.api.UpdateDNSRecord(ctx, rc, cloudflare.UpdateDNSRecordParams{Content: ip, ID: recordID, Proxied: &proxied, TTL: recordTTL})
+    }
+
+    if err != nil {
+        return fmt.Errorf("unable to set dns record: %v", err)
+    }
+
+    return nil
+}
+
+// records finds the zone and lists the records within it for a name
+func (c *Cloudflare) records(ctx context.Context, name string) (*cloudflare.ResourceContainer, []cloudflare.DNSRecord, error) {
+    rc, err := getZoneResourceContainer(c.api, ctx, c.zone)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    records, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{Name: name})
+    if err != nil {
+        return nil, nil, fmt.Errorf("unable to list dns records for %s: %v", c.zone, err)
+    }
+
+    return rc, records, nil
+}
+
+// newAPI connects to the Cloudflare API, recording metrics for each API call
+func newAPI(env env.Env, extra []cloudflare.Option) (*cloudflare.API, error) {
+    client := &http.Client{Transport: metrics.Transport("cloudflare", http.DefaultTransport)}
+
+    options := []cloudflare.Option{cloudflare.HTTPClient(client)}
+    if env.Cloudflare.URL != "" {
+        options = append(options, cloudflare.BaseURL(strings.TrimSuffix(env.Cloudflare.URL, "/")))
+    }
+
+    api, err := cloudflare.NewWithAPIToken(env.Cloudflare.ApiKey, append(options, extra...)...)
+    if err != nil {
+        return nil, fmt.Errorf("unable to connect to cloudflare api: %v", err)
+    }
+
+    return api, nil
+}
+
+// getZoneResourceContainers finds the resource container for a zone name
+func getZoneResourceContainer(api *cloudflare.API, ctx context.Context, fqzn string) (*cloudflare.ResourceContainer, error) {
+    zones, err := api.ListZones(ctx, fqzn)
+    if err != nil {
+        return nil, fmt.Errorf("unable to list dns zones: %v", err)
+    }
+
+    var zoneID string
+    for _, zone := range zones {
+        if strings.EqualFold(zone.Name, fqzn) {
+            zoneID = zone.ID
+        }
+    }
+
+    if zoneID == "" {
+        return nil, fmt.Errorf("unable to determine zone id for %s", fqzn)
+    }
+
+    return cloudflare.ZoneIdentifier(zoneID), nil
+}
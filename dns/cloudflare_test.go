@@ -0,0 +1,349 @@
+package dns
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/cloudflare/cloudflare-go"
+    "github.com/sjdaws/cloudserver-vpn/dns/dnstest"
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+type recordTest struct {
+    err      string
+    expected []string
+    modify   func(e *env.Env)
+    name     string
+    setup    func(fake *dnstest.Server, zoneID string)
+}
+
+const otherIP = "198.51.100.1"
+const serverFQDN = "vpn.example.com"
+const serverIP = "203.0.113.10"
+
+// commonTests are the failures shared by every function which looks up records in a zone
+func commonTests() []recordTest {
+    return []recordTest{
+        {
+            err:    "unable to connect to cloudflare api",
+            modify: func(e *env.Env) { e.Cloudflare.ApiKey = "" },
+            name:   "missing api key",
+        },
+        {
+            err:    "unable to list dns zones: Authentication error",
+            modify: func(e *env.Env) { e.Cloudflare.ApiKey = strings.Repeat("x", 40) },
+            name:   "invalid api key",
+        },
+        {
+            err:  "unable to list dns zones",
+            name: "zone lookup fails",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.Fail("GET /zones", dnstest.Failure{Code: 1000, Message: "Invalid user", Status: http.StatusBadRequest})
+            },
+        },
+        {
+            err:    "unable to determine zone id for example.org",
+            modify: func(e *env.Env) { e.Cloudflare.Zone = "example.org" },
+            name:   "zone not found",
+        },
+        {
+            err:  "unable to list dns records for example.com",
+            name: "record lookup fails",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.Fail("GET /zones/"+zoneID+"/dns_records", dnstest.Failure{Code: 9106, Message: "Missing X-Auth-Key", Status: http.StatusBadRequest})
+            },
+        },
+    }
+}
+
+func TestCloudflareUpsert(t *testing.T) {
+    tests := []recordTest{
+        {
+            expected: []string{serverFQDN + "=" + serverIP},
+            name:     "create record",
+        },
+        {
+            expected: []string{serverFQDN + "=" + serverIP},
+            name:     "update record",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, serverFQDN, otherIP)
+            },
+        },
+        {
+            expected: []string{"VPN.Example.com=" + serverIP},
+            name:     "case insensitive name",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, "VPN.Example.com", otherIP)
+            },
+        },
+        {
+            expected: []string{"other.example.com=" + otherIP, serverFQDN + "=" + serverIP},
+            name:     "other records unchanged",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, "other.example.com", otherIP)
+            },
+        },
+        {
+            expected: []string{serverFQDN + "=" + serverIP},
+            name:     "different name in results",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.Fail("GET /zones/"+zoneID+"/dns_records", dnstest.Failure{Body: listBody("vpn.example.com.au", otherIP), Status: http.StatusOK})
+            },
+        },
+        {
+            err:  "unable to set dns record: An identical record already exists.",
+            name: "create fails",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.Fail("POST /zones/"+zoneID+"/dns_records", dnstest.Failure{Code: 81057, Message: "An identical record already exists.", Status: http.StatusBadRequest})
+            },
+        },
+        {
+            err:  "unable to set dns record: Record does not exist.",
+            name: "update fails",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                id := fake.AddRecord(zoneID, serverFQDN, otherIP)
+                fake.Fail("PATCH /zones/"+zoneID+"/dns_records/"+id, dnstest.Failure{Code: 81044, Message: "Record does not exist.", Status: http.StatusNotFound})
+            },
+        },
+    }
+
+    runRecordTests(t, append(tests, commonTests()...), func(provider *Cloudflare) error {
+        return provider.Upsert(context.Background(), serverFQDN, serverIP)
+    })
+}
+
+func TestCloudflareUpsertRecordSettings(t *testing.T) {
+    for _, existing := range []bool{false, true} {
+        t.Run(fmt.Sprintf("existing %v", existing), func(t *testing.T) {
+            fake := dnstest.New(t)
+            zoneID := fake.AddZone("example.com")
+            if existing {
+                fake.AddRecord(zoneID, serverFQDN, otherIP)
+            }
+
+            provider, err := newTestCloudflare(testEnv(fake))
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            err = provider.Upsert(context.Background(), serverFQDN, serverIP)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            records := fake.Records()
+            if len(records) != 1 || records[0].Type != "A" || records[0].TTL != 60 || records[0].Proxied {
+                t.Errorf("expected a single unproxied A record with a 60 second ttl, got %+v", records)
+            }
+        })
+    }
+}
+
+func TestCloudflareDelete(t *testing.T) {
+    tests := []recordTest{
+        {
+            expected: []string{},
+            name:     "remove record",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, serverFQDN, serverIP)
+            },
+        },
+        {
+            expected: []string{},
+            name:     "case insensitive name",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, "VPN.Example.com", serverIP)
+            },
+        },
+        {
+            expected: []string{serverFQDN + "=" + otherIP},
+            name:     "record points elsewhere",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, serverFQDN, otherIP)
+            },
+        },
+        {
+            expected: []string{"other.example.com=" + serverIP},
+            name:     "other records unchanged",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, "other.example.com", serverIP)
+            },
+        },
+        {
+            expected: []string{},
+            name:     "no record",
+        },
+        {
+            expected: []string{},
+            name:     "different name in results",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.Fail("GET /zones/"+zoneID+"/dns_records", dnstest.Failure{Body: listBody("vpn.example.com.au", serverIP), Status: http.StatusOK})
+            },
+        },
+        {
+            err:  "unable to remove dns record: Record does not exist.",
+            name: "remove fails",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                id := fake.AddRecord(zoneID, serverFQDN, serverIP)
+                fake.Fail("DELETE /zones/"+zoneID+"/dns_records/"+id, dnstest.Failure{Code: 81044, Message: "Record does not exist.", Status: http.StatusNotFound})
+            },
+        },
+    }
+
+    runRecordTests(t, append(tests, commonTests()...), func(provider *Cloudflare) error {
+        return provider.Delete(context.Background(), serverFQDN, serverIP)
+    })
+}
+
+func TestCloudflareGet(t *testing.T) {
+    tests := []struct {
+        err      string
+        expected string
+        name     string
+        notFound bool
+        setup    func(fake *dnstest.Server, zoneID string)
+    }{
+        {
+            expected: serverIP,
+            name:     "record exists",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, "other.example.com", otherIP)
+                fake.AddRecord(zoneID, serverFQDN, serverIP)
+            },
+        },
+        {
+            expected: serverIP,
+            name:     "case insensitive name",
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, "VPN.Example.com", serverIP)
+            },
+        },
+        {
+            err:      "unable to find dns record for " + serverFQDN,
+            name:     "no record",
+            notFound: true,
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.AddRecord(zoneID, "other.example.com", serverIP)
+            },
+        },
+        {
+            err:      "unable to find dns record for " + serverFQDN,
+            name:     "different name in results",
+            notFound: true,
+            setup: func(fake *dnstest.Server, zoneID string) {
+                fake.Fail("GET /zones/"+zoneID+"/dns_records", dnstest.Failure{Body: listBody("vpn.example.com.au", serverIP), Status: http.StatusOK})
+            },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := dnstest.New(t)
+            zoneID := fake.AddZone("example.com")
+            test.setup(fake, zoneID)
+
+            provider, err := newTestCloudflare(testEnv(fake))
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            content, err := provider.Get(context.Background(), serverFQDN)
+            checkError(t, err, test.err)
+
+            if errors.Is(err, ErrNotFound) != test.notFound {
+                t.Errorf("expected not found %v, got %v", test.notFound, err)
+            }
+
+            if content != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, content)
+            }
+        })
+    }
+
+    runRecordTests(t, commonTests(), func(provider *Cloudflare) error {
+        _, err := provider.Get(context.Background(), serverFQDN)
+
+        return err
+    })
+}
+
+// checkError fails the test if an error doesn't contain the expected message, or there is an unexpected error
+func checkError(t *testing.T, err error, expected string) {
+    t.Helper()
+
+    if expected == "" && err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+        t.Fatalf("expected error containing %q, got %v", expected, err)
+    }
+}
+
+// listBody returns a successful record list response containing a single record
+func listBody(name string, content string) string {
+    return fmt.Sprintf(`{"success":true,"errors":[],"messages":[],"result":[{"id":"%032x","name":"%s","type":"A","content":"%s"}],"result_info":{"page":1,"per_page":100,"count":1,"total_count":1,"total_pages":1}}`, 999, name, content)
+}
+
+// newTestCloudflare connects to a fake API without the client rate limit, which the fake doesn't need
+func newTestCloudflare(e env.Env) (*Cloudflare, error) {
+    return NewCloudflare(e, cloudflare.UsingRateLimit(1000))
+}
+
+// runRecordTests runs a function against a fake zone for each test and compares the resulting records
+func runRecordTests(t *testing.T, tests []recordTest, run func(provider *Cloudflare) error) {
+    t.Helper()
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := dnstest.New(t)
+            zoneID := fake.AddZone("example.com")
+            fake.AddZone("example.net")
+
+            if test.setup != nil {
+                test.setup(fake, zoneID)
+            }
+
+            e := testEnv(fake)
+            if test.modify != nil {
+                test.modify(&e)
+            }
+
+            provider, err := newTestCloudflare(e)
+            if err == nil {
+                err = run(provider)
+            }
+
+            checkError(t, err, test.err)
+
+            if test.expected == nil {
+                return
+            }
+
+            records := make([]string, 0)
+            for _, record := range fake.Records() {
+                records = append(records, record.Name+"="+record.Content)
+            }
+
+            if strings.Join(records, ",") != strings.Join(test.expected, ",") {
+                t.Errorf("expected records %v, got %v", test.expected, records)
+            }
+        })
+    }
+}
+
+// testEnv returns a configuration which points at a fake API
+func testEnv(fake *dnstest.Server) env.Env {
+    var e env.Env
+    e.Cloudflare.ApiKey = dnstest.APIToken
+    e.Cloudflare.URL = fake.URL
+    e.Cloudflare.Zone = "example.com"
+    e.Server.FQDN = serverFQDN
+    e.Server.Name = "vpn"
+
+    return e
+}
@@ -0,0 +1,55 @@
+package dns
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+// Provider manages the A record which points the server FQDN at the server
+type Provider interface {
+    Delete(ctx context.Context, name string, ip string) error
+    Get(ctx context.Context, name string) (string, error)
+    Upsert(ctx context.Context, name string, ip string) error
+}
+
+const cloudflareProvider = "cloudflare"
+const hostsProvider = "hosts"
+const recordTTL = 60
+const rfc2136Provider = "rfc2136"
+const webhookProvider = "webhook"
+
+// ErrNotFound is returned when a DNS record does not exist
+var ErrNotFound = errors.New("record does not exist")
+
+// NewProvider returns the provider selected by DNS_PROVIDER
+func NewProvider(env env.Env) (Provider, error) {
+    switch strings.ToLower(env.DNS.Provider) {
+    case "", cloudflareProvider:
+        provider, err := NewCloudflare(env)
+        if err != nil {
+            return nil, err
+        }
+
+        return provider, nil
+
+    case hostsProvider:
+        return NewHosts(env), nil
+
+    case rfc2136Provider:
+        return NewRFC2136(env), nil
+
+    case webhookProvider:
+        return NewWebhook(env), nil
+    }
+
+    return nil, fmt.Errorf("unknown dns provider '%s'", env.DNS.Provider)
+}
+
+// notFound returns an error for a record which does not exist
+func notFound(name string) error {
+    return fmt.Errorf("unable to find dns record for %s: %w", name, ErrNotFound)
+}
@@ -0,0 +1,37 @@
+package dns
+
+import (
+    "fmt"
+    "testing"
+
+    "github.com/sjdaws/cloudserver-vpn/dns/dnstest"
+)
+
+func TestNewProvider(t *testing.T) {
+    tests := []struct {
+        err      string
+        expected string
+        provider string
+    }{
+        {expected: "*dns.Cloudflare", provider: ""},
+        {expected: "*dns.Cloudflare", provider: "Cloudflare"},
+        {expected: "*dns.Hosts", provider: "hosts"},
+        {expected: "*dns.RFC2136", provider: "rfc2136"},
+        {expected: "*dns.Webhook", provider: "webhook"},
+        {err: "unknown dns provider 'route53'", provider: "route53"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.provider, func(t *testing.T) {
+            e := testEnv(dnstest.New(t))
+            e.DNS.Provider = test.provider
+
+            provider, err := NewProvider(e)
+            checkError(t, err, test.err)
+
+            if test.expected != "" && fmt.Sprintf("%T", provider) != test.expected {
+                t.Errorf("expected %s, got %T", test.expected, provider)
+            }
+        })
+    }
+}
@@ -0,0 +1,225 @@
+package dnstest
+
+import (
+    "net"
+    "slices"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    miekg "github.com/miekg/dns"
+)
+
+// Nameserver is a fake authoritative server for a single zone which accepts RFC 2136 updates
+type Nameserver struct {
+    Addr string
+
+    keyName string
+    mutex   sync.Mutex
+    records map[string][]string
+    server  *miekg.Server
+    updates int
+    zone    string
+}
+
+// NewNameserver starts a nameserver for a zone on a local UDP port, if a key name is specified updates must be signed
+// with TSIG using the base64 encoded secret, it is shut down when the test finishes
+func NewNameserver(t interface {
+    Cleanup(func())
+    Fatal(...any)
+}, zone string, keyName string, secret string) *Nameserver {
+    connection, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    n := &Nameserver{
+        Addr:    connection.LocalAddr().String(),
+        records: make(map[string][]string),
+        zone:    miekg.Fqdn(strings.ToLower(zone)),
+    }
+
+    started := make(chan struct{})
+    n.server = &miekg.Server{
+        Handler:           miekg.HandlerFunc(n.serve),
+        MsgAcceptFunc:     accept,
+        NotifyStartedFunc: func() { close(started) },
+        PacketConn:        connection,
+    }
+
+    if keyName != "" {
+        n.keyName = miekg.Fqdn(keyName)
+        n.server.TsigSecret = map[string]string{n.keyName: secret}
+    }
+
+    go func() {
+        _ = n.server.ActivateAndServe()
+    }()
+    <-started
+
+    t.Cleanup(func() {
+        _ = n.server.Shutdown()
+    })
+
+    return n
+}
+
+// AddRecord adds an existing A record
+func (n *Nameserver) AddRecord(name string, ip string) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+
+    key := miekg.Fqdn(strings.ToLower(name))
+    n.records[key] = append(n.records[key], ip)
+}
+
+// Records returns the addresses for every name as "name=ip", sorted by name
+func (n *Nameserver) Records() []string {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+
+    records := make([]string, 0)
+    for name, addresses := range n.records {
+        for _, address := range addresses {
+            records = append(records, name+"="+address)
+        }
+    }
+
+    sort.Strings(records)
+
+    return records
+}
+
+// Updates returns the number of updates which have been applied
+func (n *Nameserver) Updates() int {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+
+    return n.updates
+}
+
+// accept lets updates through to the handler, the default only accepts queries and notifies
+func accept(header miekg.Header) miekg.MsgAcceptAction {
+    // Ignore responses, which have the QR bit set
+    if header.Bits&(1<<15) != 0 {
+        return miekg.MsgIgnore
+    }
+
+    return miekg.MsgAccept
+}
+
+// query answers a question with the A records for a name
+func (n *Nameserver) query(request *miekg.Msg, response *miekg.Msg) {
+    if len(request.Question) != 1 {
+        response.Rcode = miekg.RcodeFormatError
+        return
+    }
+
+    question := request.Question[0]
+    addresses, found := n.records[strings.ToLower(question.Name)]
+    if !found {
+        response.Rcode = miekg.RcodeNameError
+        return
+    }
+
+    if question.Qtype != miekg.TypeA {
+        return
+    }
+
+    for _, address := range addresses {
+        response.Answer = append(response.Answer, &miekg.A{
+            A:   net.ParseIP(address),
+            Hdr: miekg.RR_Header{Class: miekg.ClassINET, Name: question.Name, Rrtype: miekg.TypeA, Ttl: 60},
+        })
+    }
+}
+
+// serve handles queries and updates
+func (n *Nameserver) serve(writer miekg.ResponseWriter, request *miekg.Msg) {
+    response := new(miekg.Msg)
+    response.SetReply(request)
+
+    n.mutex.Lock()
+    switch request.Opcode {
+    case miekg.OpcodeQuery:
+        response.Authoritative = true
+        n.query(request, response)
+
+    case miekg.OpcodeUpdate:
+        response.Rcode = n.update(writer, request)
+
+    default:
+        response.Rcode = miekg.RcodeNotImplemented
+    }
+    n.mutex.Unlock()
+
+    if tsig := request.IsTsig(); tsig != nil && writer.TsigStatus() == nil {
+        response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+    }
+
+    _ = writer.WriteMsg(response)
+}
+
+// update applies the A record changes in an update, returning the response code
+func (n *Nameserver) update(writer miekg.ResponseWriter, request *miekg.Msg) int {
+    if n.keyName != "" {
+        tsig := request.IsTsig()
+        if tsig == nil {
+            return miekg.RcodeRefused
+        }
+
+        if !strings.EqualFold(tsig.Hdr.Name, n.keyName) || writer.TsigStatus() != nil {
+            return miekg.RcodeNotAuth
+        }
+    }
+
+    if len(request.Question) != 1 || !strings.EqualFold(request.Question[0].Name, n.zone) {
+        return miekg.RcodeNotAuth
+    }
+
+    for _, record := range request.Ns {
+        header := record.Header()
+        if !miekg.IsSubDomain(n.zone, strings.ToLower(header.Name)) {
+            return miekg.RcodeNotZone
+        }
+
+        if header.Rrtype != miekg.TypeA && header.Rrtype != miekg.TypeANY {
+            return miekg.RcodeNotImplemented
+        }
+    }
+
+    for _, record := range request.Ns {
+        header := record.Header()
+        name := strings.ToLower(header.Name)
+
+        switch header.Class {
+        case miekg.ClassANY:
+            delete(n.records, name)
+
+        case miekg.ClassNONE:
+            address := record.(*miekg.A).A.String()
+            remaining := make([]string, 0)
+            for _, existing := range n.records[name] {
+                if existing != address {
+                    remaining = append(remaining, existing)
+                }
+            }
+
+            n.records[name] = remaining
+            if len(remaining) == 0 {
+                delete(n.records, name)
+            }
+
+        default:
+            address := record.(*miekg.A).A.String()
+            if !slices.Contains(n.records[name], address) {
+                n.records[name] = append(n.records[name], address)
+            }
+        }
+    }
+
+    n.updates++
+
+    return miekg.RcodeSuccess
+}
@@ -0,0 +1,384 @@
+// Package dnstest provides an in-process fake of the Cloudflare zones and DNS records API for tests
+package dnstest
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Failure is returned instead of the normal response for the next matching request
+type Failure struct {
+    Body    string
+    Code    int
+    Message string
+    Status  int
+}
+
+type Record struct {
+    Content   string    `json:"content"`
+    Created   time.Time `json:"created_on"`
+    ID        string    `json:"id"`
+    Modified  time.Time `json:"modified_on"`
+    Name      string    `json:"name"`
+    Proxiable bool      `json:"proxiable"`
+    Proxied   bool      `json:"proxied"`
+    TTL       int       `json:"ttl"`
+    Type      string    `json:"type"`
+    ZoneID    string    `json:"zone_id"`
+    ZoneName  string    `json:"zone_name"`
+}
+
+// Server is a fake API which records the zones and DNS records created through it
+type Server struct {
+    *httptest.Server
+
+    APIToken string
+
+    failures map[string]Failure
+    mutex    sync.Mutex
+    nextID   int
+    records  []Record
+    zones    []Zone
+}
+
+type Zone struct {
+    ID     string `json:"id"`
+    Name   string `json:"name"`
+    Status string `json:"status"`
+}
+
+type recordParams struct {
+    Content string `json:"content"`
+    Name    string `json:"name"`
+    Proxied *bool  `json:"proxied"`
+    TTL     int    `json:"ttl"`
+    Type    string `json:"type"`
+}
+
+type responseInfo struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+// APIToken is accepted by default, it is 40 characters like a real scoped token
+const APIToken = "dnstest-api-token-0123456789abcdefghijkl"
+
+// New starts a fake API which accepts APIToken, it is closed when the test finishes
+func New(t interface{ Cleanup(func()) }) *Server {
+    s := &Server{
+        APIToken: APIToken,
+        failures: make(map[string]Failure),
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /zones", s.listZones)
+    mux.HandleFunc("GET /zones/{zone}/dns_records", s.listRecords)
+    mux.HandleFunc("POST /zones/{zone}/dns_records", s.createRecord)
+    mux.HandleFunc("PATCH /zones/{zone}/dns_records/{id}", s.updateRecord)
+    mux.HandleFunc("DELETE /zones/{zone}/dns_records/{id}", s.deleteRecord)
+
+    s.Server = httptest.NewServer(s.middleware(mux))
+    t.Cleanup(s.Close)
+
+    return s
+}
+
+// AddRecord adds an existing proxiable A record to a zone and returns its id
+func (s *Server) AddRecord(zoneID string, name string, content string) string {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    zone := s.zone(zoneID)
+    if zone == nil {
+        panic(fmt.Sprintf("dnstest: zone %s does not exist", zoneID))
+    }
+
+    return s.addRecord(*zone, recordParams{Content: content, Name: name, TTL: 1, Type: "A"})
+}
+
+// AddZone adds an active zone and returns its id
+func (s *Server) AddZone(name string) string {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    id := s.newID()
+    s.zones = append(s.zones, Zone{ID: id, Name: name, Status: "active"})
+
+    return id
+}
+
+// Fail responds to the next request matching a method and path, e.g. "GET /zones", with a failure
+func (s *Server) Fail(route string, failure Failure) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    s.failures[route] = failure
+}
+
+// Records returns every DNS record in every zone
+func (s *Server) Records() []Record {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    return append([]Record(nil), s.records...)
+}
+
+// addRecord stores a new record in a zone, the lock must be held
+func (s *Server) addRecord(zone Zone, params recordParams) string {
+    now := time.Now().UTC()
+    record := Record{
+        Content:   params.Content,
+        Created:   now,
+        ID:        s.newID(),
+        Modified:  now,
+        Name:      params.Name,
+        Proxiable: true,
+        TTL:       params.TTL,
+        Type:      params.Type,
+        ZoneID:    zone.ID,
+        ZoneName:  zone.Name,
+    }
+
+    if params.Proxied != nil {
+        record.Proxied = *params.Proxied
+    }
+
+    s.records = append(s.records, record)
+
+    return record.ID
+}
+
+// createRecord handles POST /zones/{zone}/dns_records
+func (s *Server) createRecord(response http.ResponseWriter, request *http.Request) {
+    var params recordParams
+    err := json.NewDecoder(request.Body).Decode(&params)
+    if err != nil || params.Name == "" || params.Type == "" || params.Content == "" {
+        writeError(response, http.StatusBadRequest, 9000, "DNS name, type and content are required.")
+        return
+    }
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    zone := s.zone(request.PathValue("zone"))
+    if zone == nil {
+        writeError(response, http.StatusNotFound, 7003, "Could not route to "+request.URL.Path+", perhaps your object identifier is invalid?")
+        return
+    }
+
+    for _, record := range s.records {
+        if record.ZoneID == zone.ID && strings.EqualFold(record.Name, params.Name) && record.Type == params.Type && record.Content == params.Content {
+            writeError(response, http.StatusBadRequest, 81057, "An identical record already exists.")
+            return
+        }
+    }
+
+    id := s.addRecord(*zone, params)
+    writeResult(response, *s.record(zone.ID, id))
+}
+
+// deleteRecord handles DELETE /zones/{zone}/dns_records/{id}
+func (s *Server) deleteRecord(response http.ResponseWriter, request *http.Request) {
+    zoneID := request.PathValue("zone")
+    id := request.PathValue("id")
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    for i, record := range s.records {
+        if record.ZoneID == zoneID && record.ID == id {
+            s.records = append(s.records[:i], s.records[i+1:]...)
+            writeResult(response, map[string]string{"id": id})
+            return
+        }
+    }
+
+    writeError(response, http.StatusNotFound, 81044, "Record does not exist.")
+}
+
+// listRecords handles GET /zones/{zone}/dns_records with an optional name filter
+func (s *Server) listRecords(response http.ResponseWriter, request *http.Request) {
+    name := request.URL.Query().Get("name")
+
+    s.mutex.Lock()
+    zone := s.zone(request.PathValue("zone"))
+    if zone == nil {
+        s.mutex.Unlock()
+        writeError(response, http.StatusNotFound, 7003, "Could not route to "+request.URL.Path+", perhaps your object identifier is invalid?")
+        return
+    }
+
+    matches := make([]Record, 0)
+    for _, record := range s.records {
+        if record.ZoneID == zone.ID && (name == "" || strings.EqualFold(record.Name, name)) {
+            matches = append(matches, record)
+        }
+    }
+    s.mutex.Unlock()
+
+    writeList(response, matches)
+}
+
+// listZones handles GET /zones with an optional name filter
+func (s *Server) listZones(response http.ResponseWriter, request *http.Request) {
+    name := request.URL.Query().Get("name")
+
+    s.mutex.Lock()
+    matches := make([]Zone, 0)
+    for _, zone := range s.zones {
+        if name == "" || strings.EqualFold(zone.Name, name) {
+            matches = append(matches, zone)
+        }
+    }
+    s.mutex.Unlock()
+
+    writeList(response, matches)
+}
+
+// middleware checks authentication and injects failures
+func (s *Server) middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        route := request.Method + " " + request.URL.Path
+
+        s.mutex.Lock()
+        failure, failed := s.failures[route]
+        delete(s.failures, route)
+        s.mutex.Unlock()
+
+        if request.Header.Get("Authorization") != "Bearer "+s.APIToken {
+            writeError(response, http.StatusForbidden, 10000, "Authentication error")
+            return
+        }
+
+        if failed {
+            if failure.Body != "" {
+                response.Header().Set("Content-Type", "application/json")
+                response.WriteHeader(failure.Status)
+                _, _ = response.Write([]byte(failure.Body))
+                return
+            }
+
+            writeError(response, failure.Status, failure.Code, failure.Message)
+            return
+        }
+
+        next.ServeHTTP(response, request)
+    })
+}
+
+// newID generates a unique 32 character hex id like the API uses, the lock must be held
+func (s *Server) newID() string {
+    s.nextID++
+
+    return fmt.Sprintf("%032x", s.nextID)
+}
+
+// record finds a record by zone and id, the lock must be held
+func (s *Server) record(zoneID string, id string) *Record {
+    for i := range s.records {
+        if s.records[i].ZoneID == zoneID && s.records[i].ID == id {
+            return &s.records[i]
+        }
+    }
+
+    return nil
+}
+
+// updateRecord handles PATCH /zones/{zone}/dns_records/{id}
+func (s *Server) updateRecord(response http.ResponseWriter, request *http.Request) {
+    var params recordParams
+    err := json.NewDecoder(request.Body).Decode(&params)
+    if err != nil {
+        writeError(response, http.StatusBadRequest, 9207, "Request body is invalid.")
+        return
+    }
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    record := s.record(request.PathValue("zone"), request.PathValue("id"))
+    if record == nil {
+        writeError(response, http.StatusNotFound, 81044, "Record does not exist.")
+        return
+    }
+
+    if params.Content != "" {
+        record.Content = params.Content
+    }
+
+    if params.Name != "" {
+        record.Name = params.Name
+    }
+
+    if params.Proxied != nil {
+        record.Proxied = *params.Proxied
+    }
+
+    if params.TTL != 0 {
+        record.TTL = params.TTL
+    }
+
+    record.Modified = time.Now().UTC()
+
+    writeResult(response, *record)
+}
+
+// zone finds a zone by id, the lock must be held
+func (s *Server) zone(id string) *Zone {
+    for i := range s.zones {
+        if s.zones[i].ID == id {
+            return &s.zones[i]
+        }
+    }
+
+    return nil
+}
+
+// writeError writes an error in the same envelope as the API
+func writeError(response http.ResponseWriter, status int, code int, message string) {
+    writeJSON(response, status, map[string]any{
+        "errors":   []responseInfo{{Code: code, Message: message}},
+        "messages": []responseInfo{},
+        "result":   nil,
+        "success":  false,
+    })
+}
+
+// writeJSON writes a value as json
+func writeJSON(response http.ResponseWriter, status int, value any) {
+    response.Header().Set("Content-Type", "application/json")
+    response.WriteHeader(status)
+    _ = json.NewEncoder(response).Encode(value)
+}
+
+// writeList writes every result as a single page in the same envelope as the API
+func writeList[T any](response http.ResponseWriter, items []T) {
+    writeJSON(response, http.StatusOK, map[string]any{
+        "errors":   []responseInfo{},
+        "messages": []responseInfo{},
+        "result":   items,
+        "result_info": map[string]int{
+            "count":       len(items),
+            "page":        1,
+            "per_page":    max(len(items), 1),
+            "total_count": len(items),
+            "total_pages": 1,
+        },
+        "success": true,
+    })
+}
+
+// writeResult writes a single result in the same envelope as the API
+func writeResult(response http.ResponseWriter, result any) {
+    writeJSON(response, http.StatusOK, map[string]any{
+        "errors":   []responseInfo{},
+        "messages": []responseInfo{},
+        "result":   result,
+        "success":  true,
+    })
+}
@@ -0,0 +1,203 @@
+package dns
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+type Hosts struct {
+    path string
+}
+
+// hostsMutex serialises changes to hosts files within this process
+var hostsMutex sync.Mutex
+
+// NewHosts creates a provider which writes records to a hosts file for a local resolver to serve
+func NewHosts(env env.Env) *Hosts {
+    return &Hosts{
+        path: env.Hosts.Path,
+    }
+}
+
+// Delete the entry for a name if it still points to an address
+func (h *Hosts) Delete(_ context.Context, name string, ip string) error {
+    hostsMutex.Lock()
+    defer hostsMutex.Unlock()
+
+    lines, err := h.read()
+    if err != nil {
+        return err
+    }
+
+    updated, removed := removeHost(lines, name, ip)
+    if !removed {
+        return nil
+    }
+
+    err = h.write(updated)
+    if err != nil {
+        return fmt.Errorf("unable to remove dns record: %v", err)
+    }
+
+    return nil
+}
+
+// Get the address a name points to
+func (h *Hosts) Get(_ context.Context, name string) (string, error) {
+    hostsMutex.Lock()
+    defer hostsMutex.Unlock()
+
+    lines, err := h.read()
+    if err != nil {
+        return "", err
+    }
+
+    for _, line := range lines {
+        fields := hostFields(line)
+        if len(fields) < 2 {
+            continue
+        }
+
+        for _, host := range fields[1:] {
+            if strings.EqualFold(host, name) {
+                return fields[0], nil
+            }
+        }
+    }
+
+    return "", notFound(name)
+}
+
+// Upsert points a name at an address, replacing any existing entry for the name
+func (h *Hosts) Upsert(_ context.Context, name string, ip string) error {
+    hostsMutex.Lock()
+    defer hostsMutex.Unlock()
+
+    lines, err := h.read()
+    if err != nil {
+        return err
+    }
+
+    lines, _ = removeHost(lines, name, "")
+    lines = append(lines, ip+"\t"+strings.ToLower(name))
+
+    err = h.write(lines)
+    if err != nil {
+        return fmt.Errorf("unable to set dns record: %v", err)
+    }
+
+    return nil
+}
+
+// read the lines of the hosts file, a missing file has no lines
+func (h *Hosts) read() ([]string, error) {
+    contents, err := os.ReadFile(h.path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, nil
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("unable to read hosts file %s: %v", h.path, err)
+    }
+
+    if len(contents) == 0 {
+        return nil, nil
+    }
+
+    return strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n"), nil
+}
+
+// write the lines of the hosts file in place rather than renaming over it, so a bind mounted file is updated
+func (h *Hosts) write(lines []string) error {
+    err := os.MkdirAll(filepath.Dir(h.path), 0755)
+    if err != nil {
+        return err
+    }
+
+    return os.WriteFile(h.path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// hostFields splits a hosts file line into an address followed by host names, ignoring comments
+func hostFields(line string) []string {
+    if index := strings.Index(line, "#"); index >= 0 {
+        line = line[:index]
+    }
+
+    return strings.Fields(line)
+}
+
+// removeHost removes a name from every line, or only lines with a matching address if one is specified
+func removeHost(lines []string, name string, ip string) ([]string, bool) {
+    updated := make([]string, 0, len(lines))
+    removed := false
+
+    for _, line := range lines {
+        fields := hostFields(line)
+        if len(fields) < 2 || (ip != "" && fields[0] != ip) {
+            updated = append(updated, line)
+            continue
+        }
+
+        hosts := 0
+        for _, host := range fields[1:] {
+            if !strings.EqualFold(host, name) {
+                hosts++
+            }
+        }
+
+        if hosts == len(fields)-1 {
+            updated = append(updated, line)
+            continue
+        }
+
+        removed = true
+        if hosts > 0 {
+            updated = append(updated, withoutHost(line, name))
+        }
+    }
+
+    return updated, removed
+}
+
+// withoutHost removes a name from a line, keeping the spacing between the remaining fields and any trailing comment
+func withoutHost(line string, name string) string {
+    content, comment := line, ""
+    if index := strings.Index(line, "#"); index >= 0 {
+        content, comment = line[:index], line[index:]
+    }
+
+    var kept strings.Builder
+    address := true
+    for content != "" {
+        field := strings.TrimLeft(content, " \t")
+        space := content[:len(content)-len(field)]
+
+        end := strings.IndexAny(field, " \t")
+        if end < 0 {
+            end = len(field)
+        }
+
+        field, content = field[:end], field[end:]
+
+        // The whitespace before a removed name is removed with it
+        if !address && strings.EqualFold(field, name) {
+            continue
+        }
+
+        if field != "" {
+            address = false
+        }
+
+        kept.WriteString(space + field)
+    }
+
+    return kept.String() + comment
+}
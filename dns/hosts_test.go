@@ -0,0 +1,108 @@
+package dns
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+func TestHosts(t *testing.T) {
+    tests := []struct {
+        content  string
+        existing string
+        expected string
+        name     string
+        notFound bool
+        run      func(provider *Hosts) (string, error)
+    }{
+        {
+            expected: serverIP + "\t" + serverFQDN + "\n",
+            name:     "upsert new file",
+            run:      func(provider *Hosts) (string, error) { return "", provider.Upsert(context.Background(), serverFQDN, serverIP) },
+        },
+        {
+            existing: "# local resolver\n127.0.0.1\tlocalhost\n" + otherIP + "\tVPN.Example.com\n",
+            expected: "# local resolver\n127.0.0.1\tlocalhost\n" + serverIP + "\t" + serverFQDN + "\n",
+            name:     "upsert replaces entry",
+            run:      func(provider *Hosts) (string, error) { return "", provider.Upsert(context.Background(), serverFQDN, serverIP) },
+        },
+        {
+            existing: otherIP + " other.example.com " + serverFQDN + " # shared\n",
+            expected: otherIP + " other.example.com # shared\n" + serverIP + "\t" + serverFQDN + "\n",
+            name:     "upsert keeps other names",
+            run:      func(provider *Hosts) (string, error) { return "", provider.Upsert(context.Background(), serverFQDN, serverIP) },
+        },
+        {
+            existing: "127.0.0.1\tlocalhost\n" + serverIP + "\t" + serverFQDN + "\n",
+            expected: "127.0.0.1\tlocalhost\n",
+            name:     "delete entry",
+            run:      func(provider *Hosts) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+        },
+        {
+            existing: serverIP + "\t" + serverFQDN + "  other.example.com\tvpn.EXAMPLE.com  # other host\n",
+            expected: serverIP + "  other.example.com  # other host\n",
+            name:     "delete keeps other names and comment",
+            run:      func(provider *Hosts) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+        },
+        {
+            existing: otherIP + "\t" + serverFQDN + "\n",
+            expected: otherIP + "\t" + serverFQDN + "\n",
+            name:     "delete entry pointing elsewhere",
+            run:      func(provider *Hosts) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+        },
+        {
+            name: "delete missing file",
+            run:  func(provider *Hosts) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+        },
+        {
+            content:  serverIP,
+            existing: "# " + otherIP + " " + serverFQDN + "\n" + serverIP + "\tvpn.EXAMPLE.com\n",
+            expected: "# " + otherIP + " " + serverFQDN + "\n" + serverIP + "\tvpn.EXAMPLE.com\n",
+            name:     "get entry",
+            run:      func(provider *Hosts) (string, error) { return provider.Get(context.Background(), serverFQDN) },
+        },
+        {
+            existing: "127.0.0.1\tlocalhost\n",
+            expected: "127.0.0.1\tlocalhost\n",
+            name:     "get missing entry",
+            notFound: true,
+            run:      func(provider *Hosts) (string, error) { return provider.Get(context.Background(), serverFQDN) },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            var e env.Env
+            e.Hosts.Path = filepath.Join(t.TempDir(), "resolver", "hosts")
+
+            if test.existing != "" {
+                err := os.MkdirAll(filepath.Dir(e.Hosts.Path), 0755)
+                if err == nil {
+                    err = os.WriteFile(e.Hosts.Path, []byte(test.existing), 0644)
+                }
+
+                if err != nil {
+                    t.Fatal(err)
+                }
+            }
+
+            content, err := test.run(NewHosts(e))
+            if errors.Is(err, ErrNotFound) != test.notFound || (err != nil && !test.notFound) {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if content != test.content {
+                t.Errorf("expected content %q, got %q", test.content, content)
+            }
+
+            contents, _ := os.ReadFile(e.Hosts.Path)
+            if string(contents) != test.expected {
+                t.Errorf("expected hosts file %q, got %q", test.expected, string(contents))
+            }
+        })
+    }
+}
@@ -0,0 +1,149 @@
+package dns
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "strings"
+    "time"
+
+    miekg "github.com/miekg/dns"
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+type RFC2136 struct {
+    algorithm string
+    client    *miekg.Client
+    keyName   string
+    server    string
+    zone      string
+}
+
+const (
+    defaultTSIGAlgorithm = "hmac-sha256"
+    rfc2136Port          = "53"
+    rfc2136Timeout       = 10 * time.Second
+    tsigFudge            = 300
+)
+
+// NewRFC2136 creates a provider which sends dynamic DNS updates, signed with TSIG if a key is configured
+func NewRFC2136(env env.Env) *RFC2136 {
+    algorithm := env.RFC2136.Algorithm
+    if algorithm == "" {
+        algorithm = defaultTSIGAlgorithm
+    }
+
+    server := env.RFC2136.Server
+    if _, _, err := net.SplitHostPort(server); err != nil {
+        server = net.JoinHostPort(server, rfc2136Port)
+    }
+
+    provider := &RFC2136{
+        algorithm: miekg.Fqdn(algorithm),
+        client:    &miekg.Client{Timeout: rfc2136Timeout},
+        server:    server,
+        zone:      miekg.Fqdn(env.DNS.Zone),
+    }
+
+    if env.RFC2136.KeyName != "" {
+        provider.keyName = miekg.Fqdn(env.RFC2136.KeyName)
+        provider.client.TsigSecret = map[string]string{provider.keyName: env.RFC2136.Secret}
+    }
+
+    return provider
+}
+
+// Delete the record for a name if it still points to an address
+func (r *RFC2136) Delete(ctx context.Context, name string, ip string) error {
+    record, err := r.record(name, ip)
+    if err != nil {
+        return fmt.Errorf("unable to remove dns record: %v", err)
+    }
+
+    // Deleting a single record rather than the set leaves a record which has been pointed elsewhere alone
+    update := new(miekg.Msg)
+    update.SetUpdate(r.zone)
+    update.Remove([]miekg.RR{record})
+
+    err = r.update(ctx, update)
+    if err != nil {
+        return fmt.Errorf("unable to remove dns record: %v", err)
+    }
+
+    return nil
+}
+
+// Get the address a name points to by querying the server directly
+func (r *RFC2136) Get(ctx context.Context, name string) (string, error) {
+    query := new(miekg.Msg)
+    query.SetQuestion(miekg.Fqdn(name), miekg.TypeA)
+
+    response, _, err := r.client.ExchangeContext(ctx, query, r.server)
+    if err != nil {
+        return "", fmt.Errorf("unable to query dns record for %s: %v", name, err)
+    }
+
+    if response.Rcode != miekg.RcodeSuccess && response.Rcode != miekg.RcodeNameError {
+        return "", fmt.Errorf("unable to query dns record for %s: %s", name, miekg.RcodeToString[response.Rcode])
+    }
+
+    for _, answer := range response.Answer {
+        record, ok := answer.(*miekg.A)
+        if ok && strings.EqualFold(record.Hdr.Name, miekg.Fqdn(name)) {
+            return record.A.String(), nil
+        }
+    }
+
+    return "", notFound(name)
+}
+
+// Upsert replaces any A records for a name with a single record pointing at an address
+func (r *RFC2136) Upsert(ctx context.Context, name string, ip string) error {
+    record, err := r.record(name, ip)
+    if err != nil {
+        return fmt.Errorf("unable to set dns record: %v", err)
+    }
+
+    update := new(miekg.Msg)
+    update.SetUpdate(r.zone)
+    update.RemoveRRset([]miekg.RR{record})
+    update.Insert([]miekg.RR{record})
+
+    err = r.update(ctx, update)
+    if err != nil {
+        return fmt.Errorf("unable to set dns record: %v", err)
+    }
+
+    return nil
+}
+
+// record creates an A record for a name and address
+func (r *RFC2136) record(name string, ip string) (*miekg.A, error) {
+    address := net.ParseIP(ip).To4()
+    if address == nil {
+        return nil, fmt.Errorf("'%s' is not an IPv4 address", ip)
+    }
+
+    return &miekg.A{
+        A:   address,
+        Hdr: miekg.RR_Header{Class: miekg.ClassINET, Name: miekg.Fqdn(name), Rrtype: miekg.TypeA, Ttl: recordTTL},
+    }, nil
+}
+
+// update sends an update to the server, signing it if a key is configured
+func (r *RFC2136) update(ctx context.Context, update *miekg.Msg) error {
+    if r.keyName != "" {
+        update.SetTsig(r.keyName, r.algorithm, tsigFudge, time.Now().Unix())
+    }
+
+    response, _, err := r.client.ExchangeContext(ctx, update, r.server)
+    if err != nil {
+        return err
+    }
+
+    if response.Rcode != miekg.RcodeSuccess {
+        return fmt.Errorf("update rejected by %s: %s", r.server, miekg.RcodeToString[response.Rcode])
+    }
+
+    return nil
+}
@@ -0,0 +1,152 @@
+package dns
+
+import (
+    "context"
+    "encoding/base64"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/sjdaws/cloudserver-vpn/dns/dnstest"
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+const tsigKeyName = "cloudserver-vpn"
+
+var tsigSecret = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestRFC2136Delete(t *testing.T) {
+    tests := []struct {
+        existing []string
+        expected []string
+        ip       string
+        name     string
+    }{
+        {existing: []string{serverIP}, expected: []string{}, ip: serverIP, name: "remove record"},
+        {existing: []string{otherIP}, expected: []string{serverFQDN + ".=" + otherIP}, ip: serverIP, name: "record points elsewhere"},
+        {existing: []string{otherIP, serverIP}, expected: []string{serverFQDN + ".=" + otherIP}, ip: serverIP, name: "other addresses unchanged"},
+        {expected: []string{}, ip: serverIP, name: "no record"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            nameserver := dnstest.NewNameserver(t, "example.com", tsigKeyName, tsigSecret)
+            for _, ip := range test.existing {
+                nameserver.AddRecord(serverFQDN, ip)
+            }
+
+            err := NewRFC2136(rfc2136Env(nameserver)).Delete(context.Background(), strings.ToUpper(serverFQDN), test.ip)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if records := nameserver.Records(); strings.Join(records, ",") != strings.Join(test.expected, ",") {
+                t.Errorf("expected records %v, got %v", test.expected, records)
+            }
+        })
+    }
+}
+
+func TestRFC2136Get(t *testing.T) {
+    nameserver := dnstest.NewNameserver(t, "example.com", "", "")
+    nameserver.AddRecord("VPN.Example.com", serverIP)
+    nameserver.AddRecord("other.example.com", otherIP)
+
+    provider := NewRFC2136(rfc2136Env(nameserver))
+
+    content, err := provider.Get(context.Background(), serverFQDN)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if content != serverIP {
+        t.Errorf("expected %s, got %s", serverIP, content)
+    }
+
+    _, err = provider.Get(context.Background(), "missing.example.com")
+    if !errors.Is(err, ErrNotFound) {
+        t.Errorf("expected not found, got %v", err)
+    }
+}
+
+func TestRFC2136Upsert(t *testing.T) {
+    tests := []struct {
+        err      string
+        existing []string
+        expected []string
+        modify   func(e *env.Env)
+        name     string
+    }{
+        {expected: []string{serverFQDN + ".=" + serverIP}, name: "create record"},
+        {existing: []string{otherIP}, expected: []string{serverFQDN + ".=" + serverIP}, name: "replace record"},
+        {existing: []string{otherIP, serverIP}, expected: []string{serverFQDN + ".=" + serverIP}, name: "replace every address"},
+        {
+            expected: []string{serverFQDN + ".=" + serverIP},
+            modify:   func(e *env.Env) { e.RFC2136.Algorithm = "hmac-sha512" },
+            name:     "other algorithm",
+        },
+        {
+            err:    "REFUSED",
+            modify: func(e *env.Env) { e.RFC2136.KeyName = ""; e.RFC2136.Secret = "" },
+            name:   "unsigned update",
+        },
+        {
+            err:    "unable to set dns record",
+            modify: func(e *env.Env) { e.RFC2136.Secret = base64.StdEncoding.EncodeToString([]byte("incorrect")) },
+            name:   "incorrect secret",
+        },
+        {
+            err:    "unable to set dns record",
+            modify: func(e *env.Env) { e.DNS.Zone = "example.org" },
+            name:   "other zone",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            nameserver := dnstest.NewNameserver(t, "example.com", tsigKeyName, tsigSecret)
+            for _, ip := range test.existing {
+                nameserver.AddRecord(serverFQDN, ip)
+            }
+
+            e := rfc2136Env(nameserver)
+            if test.modify != nil {
+                test.modify(&e)
+            }
+
+            err := NewRFC2136(e).Upsert(context.Background(), serverFQDN, serverIP)
+            checkError(t, err, test.err)
+
+            if test.err != "" {
+                if nameserver.Updates() != 0 {
+                    t.Errorf("expected update to be rejected, got %v", nameserver.Records())
+                }
+
+                return
+            }
+
+            if records := nameserver.Records(); strings.Join(records, ",") != strings.Join(test.expected, ",") {
+                t.Errorf("expected records %v, got %v", test.expected, records)
+            }
+        })
+    }
+}
+
+func TestRFC2136InvalidAddress(t *testing.T) {
+    nameserver := dnstest.NewNameserver(t, "example.com", "", "")
+
+    err := NewRFC2136(rfc2136Env(nameserver)).Upsert(context.Background(), serverFQDN, "2001:db8::1")
+    checkError(t, err, "is not an IPv4 address")
+}
+
+// rfc2136Env returns a configuration which sends signed updates to a fake nameserver
+func rfc2136Env(nameserver *dnstest.Nameserver) env.Env {
+    var e env.Env
+    e.DNS.Provider = rfc2136Provider
+    e.DNS.Zone = "example.com"
+    e.RFC2136.KeyName = tsigKeyName
+    e.RFC2136.Secret = tsigSecret
+    e.RFC2136.Server = nameserver.Addr
+
+    return e
+}
@@ -0,0 +1,145 @@
+package dns
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/metrics"
+)
+
+type Webhook struct {
+    client *http.Client
+    token  string
+    url    string
+    zone   string
+}
+
+type WebhookRequest struct {
+    Action  string `json:"action"`
+    Content string `json:"content,omitempty"`
+    Name    string `json:"name"`
+    TTL     int    `json:"ttl,omitempty"`
+    Type    string `json:"type"`
+    Zone    string `json:"zone"`
+}
+
+type WebhookResponse struct {
+    Content string `json:"content"`
+}
+
+const (
+    webhookDelete  = "delete"
+    webhookGet     = "get"
+    webhookTimeout = 30 * time.Second
+    webhookUpsert  = "upsert"
+)
+
+// NewWebhook creates a provider which sends each change to a URL for another system to apply
+func NewWebhook(env env.Env) *Webhook {
+    return &Webhook{
+        client: &http.Client{Timeout: webhookTimeout, Transport: metrics.Transport("webhook", http.DefaultTransport)},
+        token:  env.Webhook.Token,
+        url:    env.Webhook.URL,
+        zone:   env.DNS.Zone,
+    }
+}
+
+// Delete the record for a name if it still points to an address, a 404 response with a json body means there was
+// nothing to remove
+func (w *Webhook) Delete(ctx context.Context, name string, ip string) error {
+    err := w.send(ctx, WebhookRequest{Action: webhookDelete, Content: ip, Name: name}, nil)
+    if err != nil && !errors.Is(err, ErrNotFound) {
+        return fmt.Errorf("unable to remove dns record: %v", err)
+    }
+
+    return nil
+}
+
+// Get the address a name points to, the webhook responds with the content or a 404 with a json body if there is no
+// record
+func (w *Webhook) Get(ctx context.Context, name string) (string, error) {
+    var result WebhookResponse
+    err := w.send(ctx, WebhookRequest{Action: webhookGet, Name: name}, &result)
+    if errors.Is(err, ErrNotFound) || (err == nil && result.Content == "") {
+        return "", notFound(name)
+    }
+
+    if err != nil {
+        return "", fmt.Errorf("unable to retrieve dns record for %s: %v", name, err)
+    }
+
+    return result.Content, nil
+}
+
+// Upsert creates or updates the record for a name
+func (w *Webhook) Upsert(ctx context.Context, name string, ip string) error {
+    err := w.send(ctx, WebhookRequest{Action: webhookUpsert, Content: ip, Name: name, TTL: recordTTL}, nil)
+    if err != nil {
+        return fmt.Errorf("unable to set dns record: %v", err)
+    }
+
+    return nil
+}
+
+// send posts a request to the webhook and decodes the response into result if specified
+func (w *Webhook) send(ctx context.Context, payload WebhookRequest, result any) error {
+    payload.Type = "A"
+    payload.Zone = w.zone
+
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return fmt.Errorf("unable to marshal payload: %v", err)
+    }
+
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+    if err != nil {
+        return fmt.Errorf("unable to create request: %v", err)
+    }
+
+    request.Header.Set("Accept", "application/json")
+    request.Header.Set("Content-Type", "application/json")
+    if w.token != "" {
+        request.Header.Set("Authorization", "Bearer "+w.token)
+    }
+
+    response, err := w.client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer func() {
+        _ = response.Body.Close()
+    }()
+
+    contents, err := io.ReadAll(response.Body)
+    if err != nil {
+        return fmt.Errorf("unable to read response: %v", err)
+    }
+
+    // A 404 without a json body is more likely to be the wrong url than a missing record
+    if response.StatusCode == http.StatusNotFound && json.Valid(contents) {
+        return ErrNotFound
+    }
+
+    if response.StatusCode < 200 || response.StatusCode > 299 {
+        return fmt.Errorf("invalid status: %s - %s", response.Status, strings.TrimSpace(string(contents)))
+    }
+
+    if result == nil {
+        return nil
+    }
+
+    err = json.Unmarshal(contents, result)
+    if err != nil {
+        return fmt.Errorf("unable to decode response: %v", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,175 @@
+package dns
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+const webhookToken = "webhook-token"
+
+// webhookServer starts a webhook which records requests and responds with a status and body
+func webhookServer(t *testing.T, status int, body string, requests *[]WebhookRequest) *httptest.Server {
+    t.Helper()
+
+    server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        if request.Method != http.MethodPost || request.Header.Get("Authorization") != "Bearer "+webhookToken {
+            response.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+
+        var payload WebhookRequest
+        err := json.NewDecoder(request.Body).Decode(&payload)
+        if err != nil {
+            response.WriteHeader(http.StatusBadRequest)
+            return
+        }
+
+        *requests = append(*requests, payload)
+
+        response.WriteHeader(status)
+        _, _ = response.Write([]byte(body))
+    }))
+    t.Cleanup(server.Close)
+
+    return server
+}
+
+// webhookEnv returns a configuration which sends changes to a webhook
+func webhookEnv(url string) env.Env {
+    var e env.Env
+    e.DNS.Provider = webhookProvider
+    e.DNS.Zone = "example.com"
+    e.Webhook.Token = webhookToken
+    e.Webhook.URL = url
+
+    return e
+}
+
+func TestWebhook(t *testing.T) {
+    tests := []struct {
+        body     string
+        content  string
+        err      string
+        expected WebhookRequest
+        name     string
+        notFound bool
+        run      func(provider *Webhook) (string, error)
+        status   int
+    }{
+        {
+            expected: WebhookRequest{Action: webhookUpsert, Content: serverIP, Name: serverFQDN, TTL: recordTTL, Type: "A", Zone: "example.com"},
+            name:     "upsert",
+            run:      func(provider *Webhook) (string, error) { return "", provider.Upsert(context.Background(), serverFQDN, serverIP) },
+            status:   http.StatusNoContent,
+        },
+        {
+            body:     "upstream unavailable",
+            err:      "unable to set dns record: invalid status: 502 Bad Gateway - upstream unavailable",
+            expected: WebhookRequest{Action: webhookUpsert, Content: serverIP, Name: serverFQDN, TTL: recordTTL, Type: "A", Zone: "example.com"},
+            name:     "upsert fails",
+            run:      func(provider *Webhook) (string, error) { return "", provider.Upsert(context.Background(), serverFQDN, serverIP) },
+            status:   http.StatusBadGateway,
+        },
+        {
+            expected: WebhookRequest{Action: webhookDelete, Content: serverIP, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "delete",
+            run:      func(provider *Webhook) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+            status:   http.StatusOK,
+        },
+        {
+            body:     `{}`,
+            expected: WebhookRequest{Action: webhookDelete, Content: serverIP, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "delete missing record",
+            run:      func(provider *Webhook) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+            status:   http.StatusNotFound,
+        },
+        {
+            body:     "404 page not found",
+            err:      "unable to remove dns record: invalid status: 404 Not Found - 404 page not found",
+            expected: WebhookRequest{Action: webhookDelete, Content: serverIP, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "delete wrong url",
+            run:      func(provider *Webhook) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+            status:   http.StatusNotFound,
+        },
+        {
+            err:      "unable to remove dns record: invalid status: 403 Forbidden",
+            expected: WebhookRequest{Action: webhookDelete, Content: serverIP, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "delete fails",
+            run:      func(provider *Webhook) (string, error) { return "", provider.Delete(context.Background(), serverFQDN, serverIP) },
+            status:   http.StatusForbidden,
+        },
+        {
+            body:     `{"content":"` + serverIP + `"}`,
+            content:  serverIP,
+            expected: WebhookRequest{Action: webhookGet, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "get",
+            run:      func(provider *Webhook) (string, error) { return provider.Get(context.Background(), serverFQDN) },
+            status:   http.StatusOK,
+        },
+        {
+            body:     `{"error":"record not found"}`,
+            err:      "unable to find dns record for " + serverFQDN,
+            expected: WebhookRequest{Action: webhookGet, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "get missing record",
+            notFound: true,
+            run:      func(provider *Webhook) (string, error) { return provider.Get(context.Background(), serverFQDN) },
+            status:   http.StatusNotFound,
+        },
+        {
+            body:     `{}`,
+            err:      "unable to find dns record for " + serverFQDN,
+            expected: WebhookRequest{Action: webhookGet, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "get empty content",
+            notFound: true,
+            run:      func(provider *Webhook) (string, error) { return provider.Get(context.Background(), serverFQDN) },
+            status:   http.StatusOK,
+        },
+        {
+            body:     "not json",
+            err:      "unable to decode response",
+            expected: WebhookRequest{Action: webhookGet, Name: serverFQDN, Type: "A", Zone: "example.com"},
+            name:     "get invalid response",
+            run:      func(provider *Webhook) (string, error) { return provider.Get(context.Background(), serverFQDN) },
+            status:   http.StatusOK,
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            var requests []WebhookRequest
+            server := webhookServer(t, test.status, test.body, &requests)
+
+            content, err := test.run(NewWebhook(webhookEnv(server.URL)))
+            checkError(t, err, test.err)
+
+            if errors.Is(err, ErrNotFound) != test.notFound {
+                t.Errorf("expected not found %v, got %v", test.notFound, err)
+            }
+
+            if content != test.content {
+                t.Errorf("expected content %q, got %q", test.content, content)
+            }
+
+            if len(requests) != 1 || requests[0] != test.expected {
+                t.Errorf("expected request %+v, got %+v", test.expected, requests)
+            }
+        })
+    }
+}
+
+func TestWebhookUnauthorised(t *testing.T) {
+    var requests []WebhookRequest
+    server := webhookServer(t, http.StatusOK, "", &requests)
+
+    e := webhookEnv(server.URL)
+    e.Webhook.Token = ""
+
+    err := NewWebhook(e).Upsert(context.Background(), serverFQDN, serverIP)
+    checkError(t, err, "401 Unauthorized")
+}
@@ -2,34 +2,75 @@ package env
 
 import (
     "fmt"
-    "os"
+    "path/filepath"
     "strings"
-    "syscall"
+    "time"
 
     "github.com/sjdaws/cloudserver-vpn/helpers"
 )
 
+type Client struct {
+    AllowedIPs string
+    DNS        string
+}
+
 type Cloudflare struct {
     ApiKey string
+    URL    string
     Zone   string
 }
 
 type CloudServer struct {
-    ApiKey  string
-    Project int
+    ApiKey          string
+    HourlyRate      float64
+    HourlyRateAlpha string
+    Location        int
+    LocationAlpha   string
+    OS              int
+    OSAlpha         string
+    Plan            int
+    PlanAlpha       string
+    Project         int
+    URL             string
+}
+
+type Data struct {
+    Path string
+}
+
+type DNS struct {
+    Provider string
+    Zone     string
 }
 
 type Env struct {
     Cloudflare  Cloudflare
     CloudServer CloudServer
+    Data        Data
+    DNS         DNS
+    Hosts       Hosts
     HTTP        HTTP
+    Reconcile   Reconcile
+    RFC2136     RFC2136
+    Schedule    Schedule
     Server      Server
+    VPS         VPS
+    Webhook     Webhook
     Wireguard   Wireguard
+
+    origins map[string]string
+}
+
+type Hosts struct {
+    Path string
 }
 
 type HTTP struct {
-    Port      int
-    PortAlpha string
+    AdminToken string
+    Port       int
+    PortAlpha  string
+    ReadToken  string
+    Username   string
 }
 
 type Interface struct {
@@ -42,59 +83,199 @@ type Interface struct {
 type Peer struct {
     AllowedIPs string
     ID         int
+    Name       string
+    PrivateKey string
     PublicKey  string
 }
 
+type Reconcile struct {
+    Interval      time.Duration
+    IntervalAlpha string
+}
+
+type RFC2136 struct {
+    Algorithm string
+    KeyName   string
+    Secret    string
+    Server    string
+}
+
+type Schedule struct {
+    Create   string
+    Remove   string
+    Timezone string
+}
+
 type Server struct {
-    FQDN string
-    Name string
+    FQDN             string
+    IdleTimeout      time.Duration
+    IdleTimeoutAlpha string
+    MaxLifetime      time.Duration
+    MaxLifetimeAlpha string
+    MonitorPeer      int
+    MonitorPeerAlpha string
+    Name             string
+    WaitTimeout      time.Duration
+    WaitTimeoutAlpha string
+}
+
+type VPS struct {
+    Provider string
+}
+
+type Webhook struct {
+    Token string
+    URL   string
 }
 
 type Wireguard struct {
+    Client    Client
     Interface Interface
     Peers     []Peer
 }
 
-// Read environment variables into struct
-func Read() Env {
+// Secrets returns the value of every secret so they can be redacted from output
+func (e Env) Secrets() []string {
+    secrets := []string{e.Cloudflare.ApiKey, e.CloudServer.ApiKey, e.HTTP.AdminToken, e.HTTP.ReadToken, e.RFC2136.Secret, e.Webhook.Token, e.Wireguard.Interface.PrivateKey}
+    for _, peer := range e.Wireguard.Peers {
+        secrets = append(secrets, peer.PrivateKey)
+    }
+
+    return secrets
+}
+
+// Read an optional config file and environment variables into struct, environment variables take precedence
+func Read(path string) (Env, error) {
     var env Env
 
+    v, err := newValues(path)
+    if err != nil {
+        return env, err
+    }
+
     // Cloudflare
-    env.Cloudflare.ApiKey = os.Getenv("CLOUDFLARE_APIKEY")
-    env.Cloudflare.Zone = os.Getenv("CLOUDFLARE_ZONE")
+    env.Cloudflare.ApiKey = v.secret("CLOUDFLARE_APIKEY")
+    env.Cloudflare.URL = v.get("CLOUDFLARE_URL")
+    env.Cloudflare.Zone = v.get("CLOUDFLARE_ZONE")
 
     // Voyager
-    env.CloudServer.ApiKey = os.Getenv("CLOUDSERVER_APIKEY")
-    env.CloudServer.Project = helpers.AtoI(os.Getenv("CLOUDSERVER_PROJECT"))
+    env.CloudServer.ApiKey = v.secret("CLOUDSERVER_APIKEY")
+    env.CloudServer.HourlyRate = helpers.ParseFloat(v.get("CLOUDSERVER_HOURLYRATE"))
+    env.CloudServer.HourlyRateAlpha = v.get("CLOUDSERVER_HOURLYRATE")
+    env.CloudServer.Location = helpers.AtoI(v.get("CLOUDSERVER_LOCATION"))
+    env.CloudServer.LocationAlpha = v.get("CLOUDSERVER_LOCATION")
+    env.CloudServer.OS = helpers.AtoI(v.get("CLOUDSERVER_OS"))
+    env.CloudServer.OSAlpha = v.get("CLOUDSERVER_OS")
+    env.CloudServer.Plan = helpers.AtoI(v.get("CLOUDSERVER_PLAN"))
+    env.CloudServer.PlanAlpha = v.get("CLOUDSERVER_PLAN")
+    env.CloudServer.Project = helpers.AtoI(v.get("CLOUDSERVER_PROJECT"))
+    env.CloudServer.URL = v.get("CLOUDSERVER_URL")
+
+    // Data
+    env.Data.Path = v.get("DATA_PATH")
+
+    // DNS provider
+    env.DNS.Provider = strings.ToLower(v.get("DNS_PROVIDER"))
+    env.DNS.Zone = v.get("DNS_ZONE")
+
+    // Hosts file
+    env.Hosts.Path = v.get("HOSTS_PATH")
 
     // HTTP server
-    env.HTTP.Port = helpers.AtoI(os.Getenv("HTTP_PORT"))
-    env.HTTP.PortAlpha = os.Getenv("HTTP_PORT")
+    env.HTTP.AdminToken = v.secret("HTTP_ADMINTOKEN")
+    env.HTTP.Port = helpers.AtoI(v.get("HTTP_PORT"))
+    env.HTTP.PortAlpha = v.get("HTTP_PORT")
+    env.HTTP.ReadToken = v.secret("HTTP_READTOKEN")
+    env.HTTP.Username = v.get("HTTP_USERNAME")
+
+    // Reconcile
+    env.Reconcile.Interval = helpers.ParseDuration(v.get("RECONCILE_INTERVAL"))
+    env.Reconcile.IntervalAlpha = v.get("RECONCILE_INTERVAL")
+
+    // RFC 2136 dynamic DNS
+    env.RFC2136.Algorithm = strings.ToLower(v.get("RFC2136_ALGORITHM"))
+    env.RFC2136.KeyName = v.get("RFC2136_KEYNAME")
+    env.RFC2136.Secret = v.secret("RFC2136_SECRET")
+    env.RFC2136.Server = v.get("RFC2136_SERVER")
+
+    // Schedule
+    env.Schedule.Create = v.get("SCHEDULE_CREATE")
+    env.Schedule.Remove = v.get("SCHEDULE_REMOVE")
+    env.Schedule.Timezone = v.get("SCHEDULE_TIMEZONE")
 
     // Server
-    env.Server.Name = os.Getenv("SERVER_NAME")
+    env.Server.Name = v.get("SERVER_NAME")
     env.Server.FQDN = env.Server.Name
+    env.Server.IdleTimeout = helpers.ParseDuration(v.get("SERVER_IDLETIMEOUT"))
+    env.Server.IdleTimeoutAlpha = v.get("SERVER_IDLETIMEOUT")
+    env.Server.MaxLifetime = helpers.ParseDuration(v.get("SERVER_MAXLIFETIME"))
+    env.Server.MaxLifetimeAlpha = v.get("SERVER_MAXLIFETIME")
+    env.Server.MonitorPeer = helpers.AtoI(v.get("SERVER_MONITORPEER"))
+    env.Server.MonitorPeerAlpha = v.get("SERVER_MONITORPEER")
+    env.Server.WaitTimeout = helpers.ParseDuration(v.get("SERVER_WAITTIMEOUT"))
+    env.Server.WaitTimeoutAlpha = v.get("SERVER_WAITTIMEOUT")
+
+    // VPS provider
+    env.VPS.Provider = strings.ToLower(v.get("VPS_PROVIDER"))
+
+    // Webhook
+    env.Webhook.Token = v.secret("WEBHOOK_TOKEN")
+    env.Webhook.URL = v.get("WEBHOOK_URL")
+
+    // Wireguard client
+    env.Wireguard.Client.AllowedIPs = v.get("WIREGUARD_CLIENTALLOWEDIPS")
+    env.Wireguard.Client.DNS = v.get("WIREGUARD_CLIENTDNS")
 
     // Wireguard interface
-    env.Wireguard.Interface.Address = os.Getenv("WIREGUARD_ADDRESS")
-    env.Wireguard.Interface.ListenPort = helpers.AtoI(os.Getenv("WIREGUARD_LISTENPORT"))
-    env.Wireguard.Interface.ListenPortAlpha = os.Getenv("WIREGUARD_LISTENPORT")
-    env.Wireguard.Interface.PrivateKey = os.Getenv("WIREGUARD_PRIVATEKEY")
+    env.Wireguard.Interface.Address = v.get("WIREGUARD_ADDRESS")
+    env.Wireguard.Interface.ListenPort = helpers.AtoI(v.get("WIREGUARD_LISTENPORT"))
+    env.Wireguard.Interface.ListenPortAlpha = v.get("WIREGUARD_LISTENPORT")
+    env.Wireguard.Interface.PrivateKey = v.secret("WIREGUARD_PRIVATEKEY")
 
     // Wireguard peers
     for i := 0; i <= 254; i++ {
-        allowedIPs, ipsFound := syscall.Getenv(fmt.Sprintf("WIREGUARD_PEER%d_ALLOWEDIPS", i))
-        publicKey, pkFound := syscall.Getenv(fmt.Sprintf("WIREGUARD_PEER%d_PUBLICKEY", i))
+        allowedIPs := v.get(fmt.Sprintf("WIREGUARD_PEER%d_ALLOWEDIPS", i))
+        name := v.get(fmt.Sprintf("WIREGUARD_PEER%d_NAME", i))
+        privateKey := v.secret(fmt.Sprintf("WIREGUARD_PEER%d_PRIVATEKEY", i))
+        publicKey, pkFound := v.lookup(fmt.Sprintf("WIREGUARD_PEER%d_PUBLICKEY", i))
 
-        if ipsFound && pkFound {
-            env.Wireguard.Peers = append(env.Wireguard.Peers, Peer{AllowedIPs: allowedIPs, ID: i, PublicKey: publicKey})
+        if pkFound {
+            env.Wireguard.Peers = append(env.Wireguard.Peers, Peer{AllowedIPs: allowedIPs, ID: i, Name: name, PrivateKey: privateKey, PublicKey: publicKey})
         }
     }
 
     // Calculated settings
-    if env.Cloudflare.Zone != "" {
-        env.Server.FQDN = strings.ToLower(fmt.Sprintf("%s.%s", env.Server.Name, env.Cloudflare.Zone))
+    if env.Data.Path == "" {
+        env.Data.Path = "data"
+    }
+
+    if env.Hosts.Path == "" {
+        env.Hosts.Path = filepath.Join(env.Data.Path, "hosts")
+    }
+
+    // CLOUDFLARE_ZONE on its own selects Cloudflare to manage the record
+    if env.DNS.Provider == "" && env.Cloudflare.Zone != "" {
+        env.DNS.Provider = "cloudflare"
+    }
+
+    if env.DNS.Zone == "" {
+        env.DNS.Zone = env.Cloudflare.Zone
+    }
+
+    if env.DNS.Provider == "cloudflare" && env.Cloudflare.Zone == "" {
+        env.Cloudflare.Zone = env.DNS.Zone
+    }
+
+    if env.DNS.Zone != "" {
+        env.Server.FQDN = strings.ToLower(fmt.Sprintf("%s.%s", env.Server.Name, env.DNS.Zone))
+    }
+
+    env.origins = v.origins
+
+    errs := append(v.errs, v.unused()...)
+    if len(errs) > 0 {
+        return env, fmt.Errorf("unable to read configuration:\n - %s", strings.Join(errs, "\n - "))
     }
 
-    return env
+    return env, nil
 }
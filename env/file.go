@@ -0,0 +1,150 @@
+package env
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+type values struct {
+    errs    []string
+    file    map[string]string
+    origins map[string]string
+    used    map[string]bool
+}
+
+// newValues creates a set of values, reading the config file if a path is specified
+func newValues(path string) (*values, error) {
+    v := &values{
+        file:    make(map[string]string),
+        origins: make(map[string]string),
+        used:    make(map[string]bool),
+    }
+
+    if path == "" {
+        return v, nil
+    }
+
+    contents, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("unable to read config file: %v", err)
+    }
+
+    var root yaml.Node
+    err = yaml.Unmarshal(contents, &root)
+    if err != nil {
+        return nil, fmt.Errorf("unable to parse config file %s: %v", path, err)
+    }
+
+    if len(root.Content) == 0 {
+        return v, nil
+    }
+
+    return v, v.walk(path, root.Content[0], nil, nil)
+}
+
+// get returns the value for an environment variable, falling back to the config file if it isn't set
+func (v *values) get(key string) string {
+    value, _ := v.lookup(key)
+
+    return value
+}
+
+// lookup returns the value for an environment variable, falling back to the config file if it isn't set,
+// and whether the value was found in either
+func (v *values) lookup(key string) (string, bool) {
+    v.used[key] = true
+
+    value, found := os.LookupEnv(key)
+    if found {
+        delete(v.origins, key)
+        return value, true
+    }
+
+    value, found = v.file[key]
+
+    return value, found
+}
+
+// secret returns the value for a secret environment variable, if it isn't set the value is read from the
+// file specified by the same variable with a _FILE suffix, e.g. CLOUDSERVER_APIKEY_FILE
+func (v *values) secret(key string) string {
+    value, found := v.lookup(key)
+    if found && value != "" {
+        return value
+    }
+
+    path := v.get(key + "_FILE")
+    if path == "" {
+        return value
+    }
+
+    contents, err := os.ReadFile(path)
+    if err != nil {
+        v.errs = append(v.errs, fmt.Sprintf("unable to read %s_FILE: %v", key, err))
+        return ""
+    }
+
+    return strings.TrimSpace(string(contents))
+}
+
+// unused returns an error for each config file key which doesn't map to a setting
+func (v *values) unused() []string {
+    var errs []string
+
+    for key, origin := range v.origins {
+        if !v.used[key] {
+            errs = append(errs, fmt.Sprintf("%s is not a known setting", origin))
+        }
+    }
+
+    sort.Strings(errs)
+
+    return errs
+}
+
+// walk flattens a yaml node into environment variable names, e.g. wireguard.peers[1].publickey is
+// mapped to WIREGUARD_PEER1_PUBLICKEY, and records where each value was found
+func (v *values) walk(path string, node *yaml.Node, keys []string, display []string) error {
+    switch node.Kind {
+    case yaml.AliasNode:
+        return v.walk(path, node.Alias, keys, display)
+
+    case yaml.MappingNode:
+        for i := 0; i+1 < len(node.Content); i += 2 {
+            name := strings.ToLower(node.Content[i].Value)
+            err := v.walk(path, node.Content[i+1], append(keys, name), append(display, name))
+            if err != nil {
+                return err
+            }
+        }
+
+    case yaml.SequenceNode:
+        if strings.Join(keys, ".") != "wireguard.peers" {
+            return fmt.Errorf("%s:%d %s must not be a list", path, node.Line, strings.Join(display, "."))
+        }
+
+        parent := keys[:len(keys)-1]
+        for i, item := range node.Content {
+            peer := fmt.Sprintf("peer%d", i)
+            err := v.walk(path, item, append(parent[:len(parent):len(parent)], peer), append(display[:len(display):len(display)], fmt.Sprintf("[%d]", i)))
+            if err != nil {
+                return err
+            }
+        }
+
+    case yaml.ScalarNode:
+        if len(keys) == 0 {
+            return fmt.Errorf("%s:%d config file must contain settings", path, node.Line)
+        }
+
+        key := strings.ToUpper(strings.Join(keys, "_"))
+        v.file[key] = node.Value
+        v.origins[key] = fmt.Sprintf("%s:%d %s", path, node.Line, strings.ReplaceAll(strings.Join(display, "."), ".[", "["))
+    }
+
+    return nil
+}
@@ -1,61 +1,109 @@
 package env
 
 import (
+    "encoding/base64"
     "fmt"
+    "net/netip"
+    "net/url"
     "regexp"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
 
     "github.com/3th1nk/cidr"
+    "github.com/robfig/cron/v3"
+    "github.com/sjdaws/cloudserver-vpn/keys"
 )
 
+// tsigAlgorithms are the TSIG algorithms which can sign RFC 2136 updates
+var tsigAlgorithms = []string{"hmac-sha1", "hmac-sha224", "hmac-sha256", "hmac-sha384", "hmac-sha512"}
+
 // ValidateCreateEnv ensures all the required information is specified before attempting to create a VPN
 func (e Env) ValidateCreateEnv() []string {
     var errs []string
 
-    if e.Cloudflare.Zone != "" && e.Cloudflare.ApiKey == "" {
-        errs = append(errs, "CLOUDFLARE_APIKEY is mandatory when CLOUDFLARE_ZONE is set")
+    errs = append(errs, e.validateDNS()...)
+
+    if e.usesCloudServer() && e.CloudServer.ApiKey == "" {
+        errs = append(errs, fmt.Sprintf("%s is mandatory", e.key("CLOUDSERVER_APIKEY")))
     }
 
-    if e.Cloudflare.Zone != "" && len(e.Cloudflare.ApiKey) != 40 {
-        errs = append(errs, fmt.Sprintf("CLOUDFLARE_APIKEY '%s' is not valid", e.Cloudflare.ApiKey))
+    errs = append(errs, e.validateURL("CLOUDFLARE_URL", e.Cloudflare.URL)...)
+    errs = append(errs, e.validateURL("CLOUDSERVER_URL", e.CloudServer.URL)...)
+    errs = append(errs, e.validateURL("WEBHOOK_URL", e.Webhook.URL)...)
+
+    if e.CloudServer.LocationAlpha != "" && e.CloudServer.Location < 1 {
+        errs = append(errs, fmt.Sprintf("%s must be a numeric id if specified", e.key("CLOUDSERVER_LOCATION")))
     }
 
-    if e.CloudServer.ApiKey == "" {
-        errs = append(errs, "CLOUDSERVER_APIKEY is mandatory")
+    if e.CloudServer.OSAlpha != "" && e.CloudServer.OS < 1 {
+        errs = append(errs, fmt.Sprintf("%s must be a numeric id if specified", e.key("CLOUDSERVER_OS")))
+    }
+
+    if e.CloudServer.PlanAlpha != "" && e.CloudServer.Plan < 1 {
+        errs = append(errs, fmt.Sprintf("%s must be a numeric id if specified", e.key("CLOUDSERVER_PLAN")))
     }
 
     if e.Server.Name == "" {
-        errs = append(errs, "SERVER_NAME is mandatory")
+        errs = append(errs, fmt.Sprintf("%s is mandatory", e.key("SERVER_NAME")))
     } else if !regexp.MustCompile(`^\w[\w.-]*\w$`).MatchString(e.Server.Name) {
-        errs = append(errs, fmt.Sprintf("SERVER_NAME '%s' is not a valid RFC 3696 subdomain", e.Server.Name))
+        errs = append(errs, fmt.Sprintf("%s '%s' is not a valid RFC 3696 subdomain", e.key("SERVER_NAME"), e.Server.Name))
+    }
+
+    if e.Server.WaitTimeoutAlpha != "" && e.Server.WaitTimeoutAlpha != "0" && e.Server.WaitTimeout <= 0 {
+        errs = append(errs, fmt.Sprintf("%s must be a positive duration such as 5m if specified", e.key("SERVER_WAITTIMEOUT")))
     }
 
     interfaceCIDR, cidrErr := cidr.Parse(e.Wireguard.Interface.Address)
     if e.Wireguard.Interface.Address == "" {
-        errs = append(errs, "WIREGUARD_ADDRESS is mandatory")
+        errs = append(errs, fmt.Sprintf("%s is mandatory", e.key("WIREGUARD_ADDRESS")))
     } else if cidrErr != nil {
-        errs = append(errs, fmt.Sprintf("WIREGUARD_ADDRESS '%s' is not a valid CIDR", e.Wireguard.Interface.Address))
+        errs = append(errs, fmt.Sprintf("%s '%s' is not a valid CIDR", e.key("WIREGUARD_ADDRESS"), e.Wireguard.Interface.Address))
     }
 
     if e.Wireguard.Interface.ListenPortAlpha != "" && e.Wireguard.Interface.ListenPortAlpha != "0" && (e.Wireguard.Interface.ListenPort < 1 || e.Wireguard.Interface.ListenPort > 65535) {
-        errs = append(errs, "WIREGUARD_LISTENPORT must be numeric and between 0 and 65535 if specified")
+        errs = append(errs, fmt.Sprintf("%s must be numeric and between 0 and 65535 if specified", e.key("WIREGUARD_LISTENPORT")))
     }
 
     if e.Wireguard.Interface.PrivateKey == "" {
-        errs = append(errs, "WIREGUARD_PRIVATEKEY is mandatory")
-    } else if len(e.Wireguard.Interface.PrivateKey) != 44 {
-        errs = append(errs, fmt.Sprintf("WIREGUARD_PRIVATEKEY '%s' is not valid", e.Wireguard.Interface.PrivateKey))
+        errs = append(errs, fmt.Sprintf("%s is mandatory", e.key("WIREGUARD_PRIVATEKEY")))
+    } else if !keys.Valid(e.Wireguard.Interface.PrivateKey) {
+        errs = append(errs, fmt.Sprintf("%s is not valid", e.key("WIREGUARD_PRIVATEKEY")))
     }
 
     for _, peer := range e.Wireguard.Peers {
         peerCIDR, err := cidr.Parse(peer.AllowedIPs)
-        if err != nil {
-            errs = append(errs, fmt.Sprintf("WIREGUARD_PEER%d_ALLOWEDIPS '%s' is not a valid CIDR", peer.ID, peer.AllowedIPs))
-        } else if !interfaceCIDR.Contains(peerCIDR.IP().String()) {
-            errs = append(errs, fmt.Sprintf("WIREGUARD_PEER%d_ALLOWEDIPS '%s' is not within WIREGUARD_ADDRESS '%s' CIDR", peer.ID, peer.AllowedIPs, e.Wireguard.Interface.Address))
+        if peer.AllowedIPs == "" {
+            errs = append(errs, fmt.Sprintf("%s has not been allocated", e.peerKey(peer.ID, "ALLOWEDIPS")))
+        } else if err != nil {
+            errs = append(errs, fmt.Sprintf("%s '%s' is not a valid CIDR", e.peerKey(peer.ID, "ALLOWEDIPS"), peer.AllowedIPs))
+        } else if cidrErr == nil && !interfaceCIDR.Contains(peerCIDR.IP().String()) {
+            errs = append(errs, fmt.Sprintf("%s '%s' is not within %s '%s' CIDR", e.peerKey(peer.ID, "ALLOWEDIPS"), peer.AllowedIPs, e.key("WIREGUARD_ADDRESS"), e.Wireguard.Interface.Address))
+        }
+
+        if !keys.Valid(peer.PublicKey) {
+            errs = append(errs, fmt.Sprintf("%s '%s' is not valid", e.peerKey(peer.ID, "PUBLICKEY"), peer.PublicKey))
         }
 
-        if len(peer.PublicKey) != 44 {
-            errs = append(errs, fmt.Sprintf("WIREGUARD_PEER%d_PUBLICKEY '%s' is not valid", peer.ID, peer.PublicKey))
+        if peer.PrivateKey != "" {
+            publicKey, err := keys.Public(peer.PrivateKey)
+            if err != nil {
+                errs = append(errs, fmt.Sprintf("%s is not valid: %v", e.peerKey(peer.ID, "PRIVATEKEY"), err))
+            } else if publicKey != peer.PublicKey {
+                errs = append(errs, fmt.Sprintf("%s does not match %s", e.peerKey(peer.ID, "PRIVATEKEY"), e.peerKey(peer.ID, "PUBLICKEY")))
+            }
+        }
+    }
+
+    errs = append(errs, e.validatePeerUniqueness()...)
+
+    if e.Wireguard.Client.AllowedIPs != "" {
+        for _, allowedIP := range strings.Split(e.Wireguard.Client.AllowedIPs, ",") {
+            _, err := cidr.Parse(strings.TrimSpace(allowedIP))
+            if err != nil {
+                errs = append(errs, fmt.Sprintf("%s '%s' is not a valid CIDR", e.key("WIREGUARD_CLIENTALLOWEDIPS"), strings.TrimSpace(allowedIP)))
+            }
         }
     }
 
@@ -66,10 +114,14 @@ func (e Env) ValidateCreateEnv() []string {
 func (e Env) ValidateDestroyEnv() []string {
     var errs []string
 
-    if e.CloudServer.ApiKey == "" {
-        errs = append(errs, "CLOUDSERVER_APIKEY is mandatory")
+    if e.usesCloudServer() && e.CloudServer.ApiKey == "" {
+        errs = append(errs, fmt.Sprintf("%s is mandatory", e.key("CLOUDSERVER_APIKEY")))
     }
 
+    errs = append(errs, e.validateURL("CLOUDFLARE_URL", e.Cloudflare.URL)...)
+    errs = append(errs, e.validateURL("CLOUDSERVER_URL", e.CloudServer.URL)...)
+    errs = append(errs, e.validateURL("WEBHOOK_URL", e.Webhook.URL)...)
+
     return errs
 }
 
@@ -77,10 +129,188 @@ func (e Env) ValidateDestroyEnv() []string {
 func (e Env) ValidateServeEnv() []string {
     errs := e.ValidateCreateEnv()
 
+    if e.CloudServer.HourlyRateAlpha != "" && e.CloudServer.HourlyRateAlpha != "0" && e.CloudServer.HourlyRate <= 0 {
+        errs = append(errs, fmt.Sprintf("%s must be a positive number such as 0.015 if specified", e.key("CLOUDSERVER_HOURLYRATE")))
+    }
+
     // Ensure port is numeric if specified
     if e.HTTP.PortAlpha != "" && e.HTTP.PortAlpha != "0" && (e.HTTP.Port < 1 || e.HTTP.Port > 65535) {
-        errs = append(errs, "HTTP_PORT must be numeric and between 0 and 65535 if specified")
+        errs = append(errs, fmt.Sprintf("%s must be numeric and between 0 and 65535 if specified", e.key("HTTP_PORT")))
+    }
+
+    if e.Reconcile.IntervalAlpha != "" && e.Reconcile.IntervalAlpha != "0" && e.Reconcile.Interval <= 0 {
+        errs = append(errs, fmt.Sprintf("%s must be a positive duration such as 5m if specified", e.key("RECONCILE_INTERVAL")))
+    }
+
+    // Reconciling keeps a server running, so it can't be combined with anything which creates or removes it
+    if e.Reconcile.Interval > 0 && (e.Schedule.Create != "" || e.Schedule.Remove != "") {
+        errs = append(errs, fmt.Sprintf("%s can't be used with %s or %s", e.key("RECONCILE_INTERVAL"), e.key("SCHEDULE_CREATE"), e.key("SCHEDULE_REMOVE")))
+    }
+
+    if e.Reconcile.Interval > 0 && (e.Server.IdleTimeout > 0 || e.Server.MaxLifetime > 0) {
+        errs = append(errs, fmt.Sprintf("%s can't be used with %s or %s", e.key("RECONCILE_INTERVAL"), e.key("SERVER_IDLETIMEOUT"), e.key("SERVER_MAXLIFETIME")))
+    }
+
+    if e.Schedule.Create != "" {
+        _, err := cron.ParseStandard(e.Schedule.Create)
+        if err != nil {
+            errs = append(errs, fmt.Sprintf("%s '%s' is not a valid cron schedule: %v", e.key("SCHEDULE_CREATE"), e.Schedule.Create, err))
+        }
+    }
+
+    if e.Schedule.Remove != "" {
+        _, err := cron.ParseStandard(e.Schedule.Remove)
+        if err != nil {
+            errs = append(errs, fmt.Sprintf("%s '%s' is not a valid cron schedule: %v", e.key("SCHEDULE_REMOVE"), e.Schedule.Remove, err))
+        }
+    }
+
+    if e.Schedule.Timezone != "" {
+        _, err := time.LoadLocation(e.Schedule.Timezone)
+        if err != nil {
+            errs = append(errs, fmt.Sprintf("%s '%s' is not a valid timezone", e.key("SCHEDULE_TIMEZONE"), e.Schedule.Timezone))
+        }
+    }
+
+    if e.Server.IdleTimeoutAlpha != "" && e.Server.IdleTimeoutAlpha != "0" && e.Server.IdleTimeout <= 0 {
+        errs = append(errs, fmt.Sprintf("%s must be a positive duration such as 30m if specified", e.key("SERVER_IDLETIMEOUT")))
+    }
+
+    if e.Server.MaxLifetimeAlpha != "" && e.Server.MaxLifetimeAlpha != "0" && e.Server.MaxLifetime <= 0 {
+        errs = append(errs, fmt.Sprintf("%s must be a positive duration such as 8h if specified", e.key("SERVER_MAXLIFETIME")))
+    }
+
+    if e.Server.MonitorPeerAlpha != "" && !slices.ContainsFunc(e.Wireguard.Peers, func(peer Peer) bool {
+        return strconv.Itoa(peer.ID) == e.Server.MonitorPeerAlpha
+    }) {
+        errs = append(errs, fmt.Sprintf("%s '%s' is not a configured peer", e.key("SERVER_MONITORPEER"), e.Server.MonitorPeerAlpha))
+    }
+
+    if e.HTTP.AdminToken == "" && (e.HTTP.ReadToken != "" || e.HTTP.Username != "") {
+        errs = append(errs, fmt.Sprintf("%s is mandatory when %s or %s is set", e.key("HTTP_ADMINTOKEN"), e.key("HTTP_READTOKEN"), e.key("HTTP_USERNAME")))
+    }
+
+    if e.HTTP.AdminToken != "" && e.HTTP.AdminToken == e.HTTP.ReadToken {
+        errs = append(errs, fmt.Sprintf("%s must be different to %s", e.key("HTTP_READTOKEN"), e.key("HTTP_ADMINTOKEN")))
+    }
+
+    return errs
+}
+
+// validateDNS ensures the selected DNS provider has everything it needs to manage the server record
+func (e Env) validateDNS() []string {
+    var errs []string
+
+    switch e.DNS.Provider {
+    case "":
+        return nil
+
+    case "cloudflare":
+        if e.Cloudflare.ApiKey == "" {
+            errs = append(errs, fmt.Sprintf("%s is mandatory when %s is cloudflare", e.key("CLOUDFLARE_APIKEY"), e.key("DNS_PROVIDER")))
+        } else if len(e.Cloudflare.ApiKey) != 40 {
+            errs = append(errs, fmt.Sprintf("%s is not valid", e.key("CLOUDFLARE_APIKEY")))
+        }
+
+    case "hosts":
+        // The hosts file defaults to DATA_PATH/hosts so nothing else is needed
+
+    case "rfc2136":
+        if e.RFC2136.Server == "" {
+            errs = append(errs, fmt.Sprintf("%s is mandatory when %s is rfc2136", e.key("RFC2136_SERVER"), e.key("DNS_PROVIDER")))
+        }
+
+        if (e.RFC2136.KeyName == "") != (e.RFC2136.Secret == "") {
+            errs = append(errs, fmt.Sprintf("%s and %s must be specified together", e.key("RFC2136_KEYNAME"), e.key("RFC2136_SECRET")))
+        }
+
+        if _, err := base64.StdEncoding.DecodeString(e.RFC2136.Secret); err != nil {
+            errs = append(errs, fmt.Sprintf("%s must be base64 encoded", e.key("RFC2136_SECRET")))
+        }
+
+        if e.RFC2136.Algorithm != "" && !slices.Contains(tsigAlgorithms, e.RFC2136.Algorithm) {
+            errs = append(errs, fmt.Sprintf("%s must be one of %s if specified", e.key("RFC2136_ALGORITHM"), strings.Join(tsigAlgorithms, ", ")))
+        }
+
+    case "webhook":
+        if e.Webhook.URL == "" {
+            errs = append(errs, fmt.Sprintf("%s is mandatory when %s is webhook", e.key("WEBHOOK_URL"), e.key("DNS_PROVIDER")))
+        }
+
+    default:
+        return []string{fmt.Sprintf("%s '%s' must be one of cloudflare, hosts, rfc2136 or webhook if specified", e.key("DNS_PROVIDER"), e.DNS.Provider)}
+    }
+
+    if e.DNS.Zone == "" {
+        errs = append(errs, fmt.Sprintf("%s is mandatory when %s is set", e.key("DNS_ZONE"), e.key("DNS_PROVIDER")))
     }
 
     return errs
 }
+
+// validatePeerUniqueness ensures peers have unique keys and addresses which don't overlap each other or the interface
+func (e Env) validatePeerUniqueness() []string {
+    var errs []string
+
+    interfacePrefix, interfaceErr := netip.ParsePrefix(e.Wireguard.Interface.Address)
+
+    for i, peer := range e.Wireguard.Peers {
+        for _, other := range e.Wireguard.Peers[:i] {
+            if peer.PublicKey == other.PublicKey {
+                errs = append(errs, fmt.Sprintf("%s is the same as %s", e.peerKey(peer.ID, "PUBLICKEY"), e.peerKey(other.ID, "PUBLICKEY")))
+            }
+        }
+
+        peerPrefix, err := netip.ParsePrefix(peer.AllowedIPs)
+        if err != nil {
+            continue
+        }
+
+        if interfaceErr == nil && peerPrefix.Contains(interfacePrefix.Addr()) {
+            errs = append(errs, fmt.Sprintf("%s '%s' overlaps the %s interface address", e.peerKey(peer.ID, "ALLOWEDIPS"), peer.AllowedIPs, e.key("WIREGUARD_ADDRESS")))
+        }
+
+        for _, other := range e.Wireguard.Peers[:i] {
+            otherPrefix, err := netip.ParsePrefix(other.AllowedIPs)
+            if err == nil && peerPrefix.Overlaps(otherPrefix) {
+                errs = append(errs, fmt.Sprintf("%s '%s' overlaps %s '%s'", e.peerKey(peer.ID, "ALLOWEDIPS"), peer.AllowedIPs, e.peerKey(other.ID, "ALLOWEDIPS"), other.AllowedIPs))
+            }
+        }
+    }
+
+    return errs
+}
+
+// validateURL ensures an API URL is an absolute http or https URL if specified
+func (e Env) validateURL(name string, value string) []string {
+    if value == "" {
+        return nil
+    }
+
+    parsed, err := url.Parse(value)
+    if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+        return []string{fmt.Sprintf("%s '%s' must be an http or https URL", e.key(name), value)}
+    }
+
+    return nil
+}
+
+// key returns the name of an environment variable, or where it was set if it came from the config file
+func (e Env) key(name string) string {
+    origin, found := e.origins[name]
+    if found {
+        return origin
+    }
+
+    return name
+}
+
+// peerKey returns the name of an environment variable for a peer, or where it was set if it came from the config file
+func (e Env) peerKey(id int, name string) string {
+    return e.key(fmt.Sprintf("WIREGUARD_PEER%d_%s", id, name))
+}
+
+// usesCloudServer determines whether cloudserver.nz is the selected VPS provider
+func (e Env) usesCloudServer() bool {
+    return e.VPS.Provider == "" || e.VPS.Provider == "cloudserver"
+}
@@ -2,6 +2,7 @@ package helpers
 
 import (
     "strconv"
+    "time"
 )
 
 // AtoI converts alpha to integer ignoring errors
@@ -13,3 +14,23 @@ func AtoI(original string) int {
 
     return converted
 }
+
+// ParseFloat converts a decimal string such as 0.015 to a float ignoring errors
+func ParseFloat(original string) float64 {
+    converted, err := strconv.ParseFloat(original, 64)
+    if err != nil {
+        return 0
+    }
+
+    return converted
+}
+
+// ParseDuration converts a duration string such as 5m to a duration ignoring errors
+func ParseDuration(original string) time.Duration {
+    converted, err := time.ParseDuration(original)
+    if err != nil {
+        return 0
+    }
+
+    return converted
+}
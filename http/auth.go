@@ -0,0 +1,86 @@
+package http
+
+import (
+    "crypto/sha256"
+    "crypto/subtle"
+    "net/http"
+    "strings"
+)
+
+type role int
+
+const (
+    roleNone role = iota
+    roleRead
+    roleAdmin
+)
+
+const realm = "cloudserver-vpn"
+
+// authorise wraps a handler so it can only be accessed with a token granting the required role,
+// if no tokens are configured authentication is disabled
+func (h *HTTP) authorise(required role, next http.HandlerFunc) http.HandlerFunc {
+    return func(response http.ResponseWriter, request *http.Request) {
+        if h.env.HTTP.AdminToken == "" {
+            next(response, request)
+            return
+        }
+
+        granted := h.role(request)
+        if granted == roleNone {
+            response.Header().Set("WWW-Authenticate", h.challenge())
+            h.jsonError(response, http.StatusUnauthorized, "a valid token is required")
+            return
+        }
+
+        if granted < required {
+            h.jsonError(response, http.StatusForbidden, "token does not have access to this endpoint")
+            return
+        }
+
+        next(response, request)
+    }
+}
+
+// challenge returns the authentication schemes which are accepted
+func (h *HTTP) challenge() string {
+    if h.env.HTTP.Username != "" {
+        return `Bearer realm="` + realm + `", Basic realm="` + realm + `"`
+    }
+
+    return `Bearer realm="` + realm + `"`
+}
+
+// role determines the role granted by the credentials in a request
+func (h *HTTP) role(request *http.Request) role {
+    var token string
+
+    if username, password, ok := request.BasicAuth(); ok {
+        if h.env.HTTP.Username == "" || !equal(username, h.env.HTTP.Username) {
+            return roleNone
+        }
+
+        token = password
+    } else if scheme, value, found := strings.Cut(request.Header.Get("Authorization"), " "); found && strings.EqualFold(scheme, "Bearer") {
+        token = strings.TrimSpace(value)
+    }
+
+    switch {
+    case token == "":
+        return roleNone
+    case equal(token, h.env.HTTP.AdminToken):
+        return roleAdmin
+    case h.env.HTTP.ReadToken != "" && equal(token, h.env.HTTP.ReadToken):
+        return roleRead
+    }
+
+    return roleNone
+}
+
+// equal compares two strings in constant time, hashing first so the length of the expected value isn't leaked
+func equal(actual string, expected string) bool {
+    actualHash := sha256.Sum256([]byte(actual))
+    expectedHash := sha256.Sum256([]byte(expected))
+
+    return subtle.ConstantTimeCompare(actualHash[:], expectedHash[:]) == 1
+}
@@ -1,26 +1,28 @@
 package http
 
 import (
+    "context"
     "net/http"
 
-    "github.com/sjdaws/cloudserver-vpn/dns"
+    "github.com/sjdaws/cloudserver-vpn/vpn"
     "github.com/sjdaws/cloudserver-vpn/vps"
 )
 
+// create a VPS and optionally configure DNS for it in the background
 func (h *HTTP) create(response http.ResponseWriter, _ *http.Request) {
-    server, err := vps.Create(h.env)
-    if err != nil {
-        errorResponse(response, err)
-        return
+    h.startJob(response, jobCreate, h.createServer)
+}
+
+// createServer creates a VPS and optionally configures DNS for it
+func (h *HTTP) createServer(ctx context.Context, progress vps.Progress) ([]Status, error) {
+    server, err := vpn.Create(ctx, h.env, progress)
+    if err != nil && server != nil {
+        return []Status{{ID: server.ID, IP: server.IP, Name: server.Name}}, err
     }
 
-    if h.env.Cloudflare.Zone != "" {
-        err = dns.Configure(h.env, server)
-        if err != nil {
-            errorResponse(response, err)
-            return
-        }
+    if err != nil {
+        return nil, err
     }
 
-    h.status(response, nil)
+    return h.getStatus(ctx, []vps.VPS{*server}), nil
 }
@@ -0,0 +1,200 @@
+package http
+
+import (
+    "context"
+    "log"
+    "sync"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/vpn"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+    "github.com/sjdaws/cloudserver-vpn/wireguard"
+)
+
+type expiry struct {
+    activity   map[int]time.Time
+    env        env.Env
+    handshakes func(server vps.VPS) (time.Time, error)
+    mutex      sync.Mutex
+    probed     map[int]bool
+    removing   map[int]bool
+    started    time.Time
+}
+
+const monitorInterval = time.Minute
+
+// newExpiry creates a tracker for when servers should be removed
+func newExpiry(env env.Env) *expiry {
+    return &expiry{
+        activity: make(map[int]time.Time),
+        env:      env,
+        handshakes: func(server vps.VPS) (time.Time, error) {
+            return wireguard.LatestHandshake(env, wireguard.HandshakeAddress(server.IP))
+        },
+        probed:   make(map[int]bool),
+        removing: make(map[int]bool),
+        started:  time.Now(),
+    }
+}
+
+// enabled determines whether servers are removed automatically
+func (e *expiry) enabled() bool {
+    return e.env.Server.IdleTimeout > 0 || e.env.Server.MaxLifetime > 0
+}
+
+// expires returns when a server will be removed, or the zero time if it won't be
+func (e *expiry) expires(server vps.VPS) time.Time {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+
+    var expires time.Time
+    if e.env.Server.MaxLifetime > 0 && !server.Created.IsZero() {
+        expires = server.Created.Add(e.env.Server.MaxLifetime)
+    }
+
+    // Servers whose handshakes have never been read can't be shown to be idle
+    if e.env.Server.IdleTimeout > 0 && e.probed[server.ID] {
+        idle := e.lastActivity(server).Add(e.env.Server.IdleTimeout)
+        if expires.IsZero() || idle.Before(expires) {
+            expires = idle
+        }
+    }
+
+    return expires
+}
+
+// lastActivity returns the latest handshake seen for a server, or when it was created or first monitored, the lock
+// must be held
+func (e *expiry) lastActivity(server vps.VPS) time.Time {
+    activity := e.started
+    if server.Created.After(activity) {
+        activity = server.Created
+    }
+
+    if seen := e.activity[server.ID]; seen.After(activity) {
+        activity = seen
+    }
+
+    return activity
+}
+
+// prune forgets servers which no longer exist
+func (e *expiry) prune(servers []vps.VPS) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+
+    active := make(map[int]bool, len(servers))
+    for _, server := range servers {
+        active[server.ID] = true
+    }
+
+    for id := range e.activity {
+        if !active[id] {
+            delete(e.activity, id)
+        }
+    }
+
+    for id := range e.probed {
+        if !active[id] {
+            delete(e.probed, id)
+        }
+    }
+
+    for id := range e.removing {
+        if !active[id] {
+            delete(e.removing, id)
+        }
+    }
+}
+
+// probe reads the latest handshake from each server at its own address
+func (e *expiry) probe(servers []vps.VPS) {
+    if e.env.Server.IdleTimeout <= 0 {
+        return
+    }
+
+    for _, server := range servers {
+        handshake, err := e.handshakes(server)
+        if err != nil {
+            log.Printf("Unable to check whether server %d is idle: %v", server.ID, err)
+            continue
+        }
+
+        e.record(server.ID, handshake)
+    }
+}
+
+// record the latest handshake for a server, or the zero time if no peer has connected
+func (e *expiry) record(serverID int, handshake time.Time) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+
+    e.probed[serverID] = true
+
+    if handshake.After(e.activity[serverID]) {
+        e.activity[serverID] = handshake
+    }
+}
+
+// markRemoving marks whether a server is being removed, returning false if it already is
+func (e *expiry) markRemoving(serverID int, removing bool) bool {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+
+    if removing && e.removing[serverID] {
+        return false
+    }
+
+    e.removing[serverID] = removing
+
+    return true
+}
+
+// checkExpiry removes servers which have exceeded their lifetime or have been idle for too long
+func (h *HTTP) checkExpiry(ctx context.Context) {
+    servers, err := vps.ListManagedVPS(ctx, h.env)
+    if err != nil {
+        log.Printf("unable to check for expired servers: %v", err)
+        return
+    }
+
+    h.expiry.prune(servers)
+
+    h.expiry.probe(servers)
+
+    for _, server := range withCreated(h.env, servers) {
+        expires := h.expiry.expires(server)
+        if expires.IsZero() || time.Now().Before(expires) || !h.expiry.markRemoving(server.ID, true) {
+            continue
+        }
+
+        log.Printf("Server %d expired at %s, removing it", server.ID, expires.Format(time.RFC3339))
+
+        _, err := h.jobs.start(jobRemove, func(ctx context.Context, progress vps.Progress) ([]Status, error) {
+            err := vpn.Remove(ctx, h.env, server, progress)
+            if err != nil {
+                // Allow the next check to try again
+                h.expiry.markRemoving(server.ID, false)
+                return nil, err
+            }
+
+            return []Status{{ID: server.ID, IP: server.IP, Name: server.Name}}, nil
+        })
+        if err != nil {
+            log.Printf("Unable to remove expired server %d: %v", server.ID, err)
+            h.expiry.markRemoving(server.ID, false)
+        }
+    }
+}
+
+// monitor periodically removes expired servers
+func (h *HTTP) monitor() {
+    ticker := time.NewTicker(monitorInterval)
+    defer ticker.Stop()
+
+    for {
+        h.checkExpiry(context.Background())
+        <-ticker.C
+    }
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+)
+
+func TestExpiryProbesEachServer(t *testing.T) {
+    var e env.Env
+    e.Server.IdleTimeout = 30 * time.Minute
+
+    created := time.Now().Add(-2 * time.Hour)
+    active := vps.VPS{Created: created, ID: 1, IP: "192.0.2.1"}
+    idle := vps.VPS{Created: created, ID: 2, IP: "192.0.2.2"}
+    unreachable := vps.VPS{Created: created, ID: 3, IP: "192.0.2.3"}
+
+    handshakes := map[string]time.Time{
+        active.IP: time.Now().Add(-time.Minute),
+        idle.IP:   created.Add(time.Minute),
+    }
+
+    tracker := newExpiry(e)
+    tracker.started = created
+
+    var probed []string
+    tracker.handshakes = func(server vps.VPS) (time.Time, error) {
+        probed = append(probed, server.IP)
+
+        handshake, found := handshakes[server.IP]
+        if !found {
+            return time.Time{}, errors.New("connection refused")
+        }
+
+        return handshake, nil
+    }
+
+    tracker.probe([]vps.VPS{active, idle, unreachable})
+
+    if len(probed) != 3 || probed[0] != active.IP || probed[1] != idle.IP || probed[2] != unreachable.IP {
+        t.Fatalf("expected every server to be probed at its own address, got %v", probed)
+    }
+
+    if expires := tracker.expires(active); !expires.After(time.Now()) {
+        t.Errorf("expected active server to expire in the future, got %s", expires)
+    }
+
+    if expires := tracker.expires(idle); expires.IsZero() || expires.After(time.Now()) {
+        t.Errorf("expected idle server to have expired, got %s", expires)
+    }
+
+    // A server whose handshakes couldn't be read is never considered idle
+    if expires := tracker.expires(unreachable); !expires.IsZero() {
+        t.Errorf("expected unreachable server not to expire, got %s", expires)
+    }
+}
+
+func TestExpiryProbeDisabled(t *testing.T) {
+    tracker := newExpiry(env.Env{})
+    tracker.handshakes = func(server vps.VPS) (time.Time, error) {
+        t.Fatalf("unexpected probe of server %d", server.ID)
+        return time.Time{}, nil
+    }
+
+    tracker.probe([]vps.VPS{{ID: 1, IP: "192.0.2.1"}})
+}
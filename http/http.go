@@ -8,18 +8,41 @@ import (
     "strings"
 
     "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/metrics"
+    "github.com/sjdaws/cloudserver-vpn/redact"
 )
 
+type Error struct {
+    Error string `json:"error"`
+}
+
 type HTTP struct {
-    env env.Env
+    env       env.Env
+    expiry    *expiry
+    jobs      *jobs
+    redactor  *redact.Redactor
+    scheduler *scheduler
+}
+
+// unmatchedResponse discards the plain text body the mux writes for requests which don't match a route
+type unmatchedResponse struct {
+    http.ResponseWriter
+
+    status int
 }
 
+const apiPrefix = "/api/v1"
 const httpPort = 5252
 
 // New creates a new HTTP instance
 func New(env env.Env) *HTTP {
+    redactor := redact.New(env.Secrets()...)
+
     return &HTTP{
-        env: env,
+        env:      env,
+        expiry:   newExpiry(env),
+        jobs:     newJobs(env, redactor),
+        redactor: redactor,
     }
 }
 
@@ -35,35 +58,110 @@ func (h *HTTP) Start() error {
         port = httpPort
     }
 
-    http.HandleFunc("/create", h.create)
-    http.HandleFunc("/remove", h.remove)
-    http.HandleFunc("/status", h.status)
+    if h.env.HTTP.AdminToken == "" {
+        log.Print("HTTP_ADMINTOKEN is not set, anyone who can reach the http server can create and remove servers")
+    }
+
+    if h.env.CloudServer.HourlyRate == 0 && h.env.CloudServer.Plan != 0 {
+        log.Printf("CLOUDSERVER_PLAN is set but CLOUDSERVER_HOURLYRATE is not, estimated spend uses the default plan rate of %g", defaultHourlyRate)
+    }
+
+    go h.metricsLoop()
+
+    if h.expiry.enabled() {
+        go h.monitor()
+    }
+
+    if h.env.Reconcile.Interval > 0 {
+        go h.reconcileLoop()
+    }
+
+    if h.env.Schedule.Create != "" || h.env.Schedule.Remove != "" {
+        err := h.schedule()
+        if err != nil {
+            return fmt.Errorf("unable to schedule jobs: %v", err)
+        }
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET "+apiPrefix+"/jobs", h.authorise(roleRead, h.listJobs))
+    mux.HandleFunc("GET "+apiPrefix+"/jobs/{id}", h.authorise(roleRead, h.getJob))
+    mux.HandleFunc("GET "+apiPrefix+"/jobs/{id}/events", h.authorise(roleRead, h.jobEvents))
+    mux.HandleFunc("GET /metrics", h.authorise(roleRead, metrics.Handler().ServeHTTP))
+    mux.HandleFunc("POST "+apiPrefix+"/reconcile", h.authorise(roleAdmin, h.reconcile))
+    mux.HandleFunc("GET "+apiPrefix+"/servers", h.authorise(roleRead, h.list))
+    mux.HandleFunc("POST "+apiPrefix+"/servers", h.authorise(roleAdmin, h.create))
+    mux.HandleFunc("DELETE "+apiPrefix+"/servers", h.authorise(roleAdmin, h.removeAll))
+    mux.HandleFunc("GET "+apiPrefix+"/servers/{id}", h.authorise(roleRead, h.get))
+    mux.HandleFunc("DELETE "+apiPrefix+"/servers/{id}", h.authorise(roleAdmin, h.remove))
+    mux.HandleFunc("GET "+apiPrefix+"/servers/{id}/peers", h.authorise(roleAdmin, h.peers))
+    mux.HandleFunc("GET "+apiPrefix+"/servers/{id}/peers/{peer}", h.authorise(roleAdmin, h.peer))
+    mux.HandleFunc("GET "+apiPrefix+"/servers/{id}/peers/{peer}/qr", h.authorise(roleAdmin, h.qr))
+    mux.HandleFunc("GET "+apiPrefix+"/state", h.authorise(roleRead, h.getState))
+    mux.HandleFunc("GET "+apiPrefix+"/status", h.authorise(roleRead, h.status))
     log.Printf("listening on port %d", port)
 
-    return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+    return http.ListenAndServe(fmt.Sprintf(":%d", port), h.unmatched(mux, metrics.Instrument(mux)))
 }
 
-// errorResponse writes an error to the response buffer
-func errorResponse(response http.ResponseWriter, err error) {
-    response.WriteHeader(http.StatusInternalServerError)
-    _, err = response.Write([]byte(err.Error()))
+// unmatched sends the not found and method not allowed responses from the mux as json errors
+func (h *HTTP) unmatched(mux *http.ServeMux, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        _, pattern := mux.Handler(request)
+        if pattern != "" {
+            next.ServeHTTP(response, request)
+            return
+        }
+
+        capture := &unmatchedResponse{ResponseWriter: response, status: http.StatusOK}
+        next.ServeHTTP(capture, request)
+        h.jsonError(response, capture.status, strings.ToLower(http.StatusText(capture.status)))
+    })
+}
+
+// errorResponse writes an error to the response buffer with any secrets removed
+func (h *HTTP) errorResponse(response http.ResponseWriter, err error) {
+    h.jsonError(response, http.StatusInternalServerError, err.Error())
+}
+
+// jsonError writes an error message to the response buffer as json with any secrets removed
+func (h *HTTP) jsonError(response http.ResponseWriter, status int, message string) {
+    body, err := json.Marshal(Error{Error: h.redactor.String(message)})
+    if err != nil {
+        log.Printf("unable to marshal http error response: %v", err)
+        return
+    }
+
+    response.Header().Set("Content-Type", "application/json")
+    response.WriteHeader(status)
+    _, err = response.Write(body)
     if err != nil {
         log.Printf("unable to write http response: %v", err)
     }
 }
 
 // sendResponse marshals and sends an HTTP response
-func sendResponse(response http.ResponseWriter, v any) {
-    response.WriteHeader(http.StatusOK)
+func (h *HTTP) sendResponse(response http.ResponseWriter, status int, v any) {
     body, err := json.Marshal(v)
     if err != nil {
-        errorResponse(response, err)
+        h.errorResponse(response, err)
         return
     }
 
+    response.Header().Set("Content-Type", "application/json")
+    response.WriteHeader(status)
     _, err = response.Write(body)
     if err != nil {
-        errorResponse(response, err)
-        return
+        log.Printf("unable to write http response: %v", err)
     }
 }
+
+// Write discards the body
+func (u *unmatchedResponse) Write(body []byte) (int, error) {
+    return len(body), nil
+}
+
+// WriteHeader records the status without sending it
+func (u *unmatchedResponse) WriteHeader(status int) {
+    u.status = status
+}
@@ -0,0 +1,378 @@
+package http
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "slices"
+    "sync"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/redact"
+    "github.com/sjdaws/cloudserver-vpn/state"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+)
+
+type Job struct {
+    Created time.Time `json:"created"`
+    Error   string    `json:"error,omitempty"`
+    ID      string    `json:"id"`
+    Servers []Status  `json:"servers,omitempty"`
+    State   string    `json:"state"`
+    Steps   []Step    `json:"steps"`
+    Type    string    `json:"type"`
+    Updated time.Time `json:"updated"`
+}
+
+type Step struct {
+    Finished *time.Time `json:"finished,omitempty"`
+    Name     string     `json:"name"`
+    Started  time.Time  `json:"started"`
+    State    string     `json:"state"`
+}
+
+type jobs struct {
+    env         env.Env
+    jobs        map[string]*Job
+    mutex       sync.Mutex
+    order       []string
+    pending     int
+    queue       chan queuedJob
+    redactor    *redact.Redactor
+    submit      sync.Mutex
+    subscribers map[string][]chan struct{}
+}
+
+type queuedJob struct {
+    id  string
+    run work
+}
+
+// work is run in the background by a job and returns the servers it affected
+type work func(ctx context.Context, progress vps.Progress) ([]Status, error)
+
+const (
+    jobCreate      = "create"
+    jobRemove      = "remove"
+    maxJobs        = 100
+    stepQueued     = "queued"
+    stateFailed    = "failed"
+    stateRunning   = "running"
+    stateSucceeded = "succeeded"
+)
+
+// errQueueFull is returned when a job can't be started because too many jobs are waiting to run
+var errQueueFull = errors.New("too many jobs are queued, try again later")
+
+// newJobs creates an empty job tracker and starts the worker which runs jobs
+func newJobs(env env.Env, redactor *redact.Redactor) *jobs {
+    j := &jobs{
+        env:         env,
+        jobs:        make(map[string]*Job),
+        queue:       make(chan queuedJob, maxJobs),
+        redactor:    redactor,
+        subscribers: make(map[string][]chan struct{}),
+    }
+
+    go j.worker()
+
+    return j
+}
+
+// get returns a copy of a job
+func (j *jobs) get(id string) (Job, bool) {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    job, found := j.jobs[id]
+    if !found {
+        return Job{}, false
+    }
+
+    return job.copy(), true
+}
+
+// list returns a copy of every job, newest first
+func (j *jobs) list() []Job {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    list := make([]Job, 0, len(j.order))
+    for i := len(j.order) - 1; i >= 0; i-- {
+        list = append(list, j.jobs[j.order[i]].copy())
+    }
+
+    return list
+}
+
+// start queues work to run in the background and returns the job tracking it, or errQueueFull if too many jobs are
+// waiting to run
+func (j *jobs) start(jobType string, run work) (Job, error) {
+    now := time.Now()
+    job := &Job{
+        Created: now,
+        ID:      newJobID(),
+        State:   stateRunning,
+        Steps:   make([]Step, 0),
+        Type:    jobType,
+        Updated: now,
+    }
+
+    // Jobs are queued in the order they are submitted
+    j.submit.Lock()
+    defer j.submit.Unlock()
+
+    j.mutex.Lock()
+    if j.pending > 0 {
+        job.Steps = append(job.Steps, Step{Name: stepQueued, Started: now, State: stateRunning})
+    }
+    j.jobs[job.ID] = job
+    j.order = append(j.order, job.ID)
+    j.pending++
+    j.prune()
+    snapshot := job.copy()
+    j.mutex.Unlock()
+
+    select {
+    case j.queue <- queuedJob{id: job.ID, run: run}:
+        return snapshot, nil
+    default:
+    }
+
+    j.mutex.Lock()
+    delete(j.jobs, job.ID)
+    j.order = slices.DeleteFunc(j.order, func(id string) bool {
+        return id == job.ID
+    })
+    j.pending--
+    j.mutex.Unlock()
+
+    return Job{}, errQueueFull
+}
+
+// subscribe returns a channel which is notified each time a job changes and a function to unsubscribe
+func (j *jobs) subscribe(id string) (<-chan struct{}, func(), bool) {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    if _, found := j.jobs[id]; !found {
+        return nil, nil, false
+    }
+
+    notify := make(chan struct{}, 1)
+    j.subscribers[id] = append(j.subscribers[id], notify)
+
+    unsubscribe := func() {
+        j.mutex.Lock()
+        defer j.mutex.Unlock()
+
+        j.subscribers[id] = slices.DeleteFunc(j.subscribers[id], func(existing chan struct{}) bool {
+            return existing == notify
+        })
+        if len(j.subscribers[id]) == 0 {
+            delete(j.subscribers, id)
+        }
+    }
+
+    return notify, unsubscribe, true
+}
+
+// finish marks a job as succeeded or failed, recording any servers it affected even if it failed
+func (j *jobs) finish(id string, servers []Status, err error) {
+    j.update(id, func(job *Job) {
+        job.Servers = servers
+
+        if err != nil {
+            job.finishStep(stateFailed)
+            job.Error = j.redactor.String(err.Error())
+            job.State = stateFailed
+            log.Printf("%s job %s failed: %v", job.Type, job.ID, err)
+            return
+        }
+
+        job.finishStep(stateSucceeded)
+        job.State = stateSucceeded
+    })
+}
+
+// prune removes the oldest finished jobs once there are too many, the lock must be held
+func (j *jobs) prune() {
+    for i := 0; len(j.order) > maxJobs && i < len(j.order); {
+        id := j.order[i]
+        if j.jobs[id].State == stateRunning {
+            i++
+            continue
+        }
+
+        delete(j.jobs, id)
+        j.order = slices.Delete(j.order, i, i+1)
+    }
+}
+
+// step marks the current step of a job as succeeded and starts the next step
+func (j *jobs) step(id string, name string) {
+    j.update(id, func(job *Job) {
+        job.finishStep(stateSucceeded)
+        job.Steps = append(job.Steps, Step{Name: name, Started: time.Now(), State: stateRunning})
+    })
+}
+
+// update changes a job and notifies subscribers
+func (j *jobs) update(id string, change func(job *Job)) {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    job, found := j.jobs[id]
+    if !found {
+        return
+    }
+
+    change(job)
+    job.Updated = time.Now()
+
+    for _, notify := range j.subscribers[id] {
+        select {
+        case notify <- struct{}{}:
+        default:
+        }
+    }
+}
+
+// worker runs queued jobs one at a time in the order they were started so creates and removes can't interleave,
+// holding the operations lock while each job runs so they can't interleave with the cli either
+func (j *jobs) worker() {
+    for queued := range j.queue {
+        progress := func(step string) {
+            j.step(queued.id, step)
+        }
+
+        servers, err := j.run(queued, progress)
+        j.finish(queued.id, servers, err)
+
+        j.mutex.Lock()
+        j.pending--
+        j.mutex.Unlock()
+    }
+}
+
+// run runs a queued job while holding the operations lock
+func (j *jobs) run(queued queuedJob, progress vps.Progress) ([]Status, error) {
+    unlock, err := state.LockOperations(j.env)
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    return queued.run(context.Background(), progress)
+}
+
+// copy returns a copy of a job which can be used without holding the lock
+func (job *Job) copy() Job {
+    copied := *job
+    copied.Servers = slices.Clone(job.Servers)
+    copied.Steps = slices.Clone(job.Steps)
+
+    return copied
+}
+
+// finishStep sets the state of the running step
+func (job *Job) finishStep(state string) {
+    if len(job.Steps) == 0 {
+        return
+    }
+
+    last := &job.Steps[len(job.Steps)-1]
+    if last.State == stateRunning {
+        finished := time.Now()
+        last.Finished = &finished
+        last.State = state
+    }
+}
+
+// getJob returns a single job
+func (h *HTTP) getJob(response http.ResponseWriter, request *http.Request) {
+    job, found := h.jobs.get(request.PathValue("id"))
+    if !found {
+        h.jsonError(response, http.StatusNotFound, fmt.Sprintf("job %s not found", request.PathValue("id")))
+        return
+    }
+
+    h.sendResponse(response, http.StatusOK, job)
+}
+
+// jobEvents streams a job as server-sent events each time it changes until it finishes
+func (h *HTTP) jobEvents(response http.ResponseWriter, request *http.Request) {
+    id := request.PathValue("id")
+
+    notify, unsubscribe, found := h.jobs.subscribe(id)
+    if !found {
+        h.jsonError(response, http.StatusNotFound, fmt.Sprintf("job %s not found", id))
+        return
+    }
+    defer unsubscribe()
+
+    controller := http.NewResponseController(response)
+    response.Header().Set("Cache-Control", "no-cache")
+    response.Header().Set("Content-Type", "text/event-stream")
+    response.WriteHeader(http.StatusOK)
+
+    for {
+        job, found := h.jobs.get(id)
+        if !found {
+            return
+        }
+
+        body, err := json.Marshal(job)
+        if err != nil {
+            log.Printf("unable to marshal job %s: %v", id, err)
+            return
+        }
+
+        _, err = fmt.Fprintf(response, "event: job\ndata: %s\n\n", body)
+        if err == nil {
+            err = controller.Flush()
+        }
+
+        if err != nil || job.State != stateRunning {
+            return
+        }
+
+        select {
+        case <-notify:
+        case <-request.Context().Done():
+            return
+        }
+    }
+}
+
+// listJobs returns every job, newest first
+func (h *HTTP) listJobs(response http.ResponseWriter, _ *http.Request) {
+    h.sendResponse(response, http.StatusOK, h.jobs.list())
+}
+
+// startJob starts a job and responds with it, or with service unavailable if too many jobs are queued
+func (h *HTTP) startJob(response http.ResponseWriter, jobType string, run work) {
+    job, err := h.jobs.start(jobType, run)
+    if err != nil {
+        response.Header().Set("Retry-After", "60")
+        h.jsonError(response, http.StatusServiceUnavailable, err.Error())
+        return
+    }
+
+    response.Header().Set("Location", fmt.Sprintf("%s/jobs/%s", apiPrefix, job.ID))
+    h.sendResponse(response, http.StatusAccepted, job)
+}
+
+// newJobID generates a random job id
+func newJobID() string {
+    id := make([]byte, 8)
+    _, _ = rand.Read(id)
+
+    return hex.EncodeToString(id)
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+    "context"
+    "log"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/metrics"
+    "github.com/sjdaws/cloudserver-vpn/state"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+)
+
+// defaultHourlyRate is the hourly cost of the default plan
+const defaultHourlyRate = 0.015
+const metricsInterval = time.Minute
+
+// metricsLoop periodically records the active servers and estimated spend
+func (h *HTTP) metricsLoop() {
+    ticker := time.NewTicker(metricsInterval)
+    defer ticker.Stop()
+
+    for {
+        h.recordMetrics()
+        <-ticker.C
+    }
+}
+
+// recordMetrics records the active servers, how long they have been running and the estimated spend for every server in
+// the saved state, including removed servers which have been pruned from it
+func (h *HTTP) recordMetrics() {
+    servers, err := vps.ListManagedVPS(context.Background(), h.env)
+    if err != nil {
+        log.Printf("unable to record server metrics: %v", err)
+        return
+    }
+
+    active := make([]metrics.Server, 0, len(servers))
+    running := make(map[int]bool, len(servers))
+    for _, server := range withCreated(h.env, servers) {
+        active = append(active, metrics.Server{Created: server.Created, ID: server.ID, Name: server.Name})
+        running[server.ID] = true
+    }
+
+    metrics.SetServers(active)
+
+    saved, err := state.Read(h.env)
+    if err != nil {
+        log.Printf("unable to record spend metrics: %v", err)
+        return
+    }
+
+    hours := saved.PrunedHours
+    for _, server := range saved.Servers {
+        finished := time.Now()
+        if server.Removed != nil {
+            finished = *server.Removed
+        } else if !running[server.ID] {
+            continue
+        }
+
+        if !server.Created.IsZero() {
+            hours += finished.Sub(server.Created).Hours()
+        }
+    }
+
+    rate := h.env.CloudServer.HourlyRate
+    if rate == 0 {
+        rate = defaultHourlyRate
+    }
+
+    metrics.SetSpend(hours * rate)
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+
+    "github.com/sjdaws/cloudserver-vpn/helpers"
+    "github.com/sjdaws/cloudserver-vpn/vpn"
+    "github.com/sjdaws/cloudserver-vpn/wireguard"
+)
+
+const qrSize = 512
+
+// peer returns the client configuration for a single peer as plain text
+func (h *HTTP) peer(response http.ResponseWriter, request *http.Request) {
+    client, found := h.findPeer(response, request)
+    if !found {
+        return
+    }
+
+    response.Header().Set("Content-Type", "text/plain")
+    response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"peer%d.conf\"", client.ID))
+    _, err := response.Write([]byte(client.Config))
+    if err != nil {
+        h.errorResponse(response, err)
+    }
+}
+
+// peers returns the client configuration for every peer
+func (h *HTTP) peers(response http.ResponseWriter, request *http.Request) {
+    server, found := h.findServer(response, request)
+    if !found {
+        return
+    }
+
+    configs, err := vpn.ServerClientConfigs(h.env, server)
+    if err != nil {
+        h.errorResponse(response, err)
+        return
+    }
+
+    h.sendResponse(response, http.StatusOK, configs)
+}
+
+// qr returns a QR code image of the client configuration for a single peer
+func (h *HTTP) qr(response http.ResponseWriter, request *http.Request) {
+    client, found := h.findPeer(response, request)
+    if !found {
+        return
+    }
+
+    image, err := client.PNG(qrSize)
+    if errors.Is(err, wireguard.ErrNoPrivateKey) {
+        h.jsonError(response, http.StatusUnprocessableEntity, err.Error())
+        return
+    }
+
+    if err != nil {
+        h.errorResponse(response, err)
+        return
+    }
+
+    response.Header().Set("Content-Type", "image/png")
+    _, err = response.Write(image)
+    if err != nil {
+        h.errorResponse(response, err)
+    }
+}
+
+// findPeer finds the client configuration for the server and peer in the request path, sending a not found
+// response if either doesn't exist
+func (h *HTTP) findPeer(response http.ResponseWriter, request *http.Request) (*wireguard.ClientConfig, bool) {
+    server, found := h.findServer(response, request)
+    if !found {
+        return nil, false
+    }
+
+    configs, err := vpn.ServerClientConfigs(h.env, server)
+    if err != nil {
+        h.errorResponse(response, err)
+        return nil, false
+    }
+
+    peerID := helpers.AtoI(request.PathValue("peer"))
+    for _, client := range configs {
+        if client.ID == peerID && request.PathValue("peer") != "" {
+            return &client, true
+        }
+    }
+
+    h.jsonError(response, http.StatusNotFound, fmt.Sprintf("peer %s not found", request.PathValue("peer")))
+
+    return nil, false
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/vpn"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+)
+
+const jobReconcile = "reconcile"
+
+// reconcile starts a job to make the running servers match the configuration
+func (h *HTTP) reconcile(response http.ResponseWriter, _ *http.Request) {
+    h.startJob(response, jobReconcile, h.reconcileServers)
+}
+
+// reconcileLoop periodically makes the running servers match the configuration
+func (h *HTTP) reconcileLoop() {
+    ticker := time.NewTicker(h.env.Reconcile.Interval)
+    defer ticker.Stop()
+
+    for {
+        _, err := h.jobs.start(jobReconcile, h.reconcileServers)
+        if err != nil {
+            log.Printf("Unable to start %s: %v", jobReconcile, err)
+        }
+
+        <-ticker.C
+    }
+}
+
+// reconcileServers makes the running servers match the configuration, logging each corrective action
+func (h *HTTP) reconcileServers(ctx context.Context, progress vps.Progress) ([]Status, error) {
+    server, err := vpn.Reconcile(ctx, h.env, progress, func(action string) {
+        log.Print(action)
+    })
+    if err != nil && server != nil {
+        return []Status{{ID: server.ID, IP: server.IP, Name: server.Name}}, err
+    }
+
+    if err != nil {
+        return nil, err
+    }
+
+    return h.getStatus(ctx, []vps.VPS{*server}), nil
+}
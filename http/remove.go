@@ -1,32 +1,61 @@
 package http
 
 import (
+    "context"
     "net/http"
 
+    "github.com/sjdaws/cloudserver-vpn/vpn"
     "github.com/sjdaws/cloudserver-vpn/vps"
 )
 
-func (h *HTTP) remove(response http.ResponseWriter, _ *http.Request) {
-    var active []int
-    var err error
-
-    servers, err := vps.ListActiveVPS(h.env)
-    if err != nil {
-        errorResponse(response, err)
+// remove destroys a single server in the background
+func (h *HTTP) remove(response http.ResponseWriter, request *http.Request) {
+    server, found := h.findServer(response, request)
+    if !found {
         return
     }
 
-    for _, server := range servers {
-        active = append(active, server.ID)
+    h.startJob(response, jobRemove, func(ctx context.Context, progress vps.Progress) ([]Status, error) {
+        err := vpn.Remove(ctx, h.env, *server, progress)
+        if err != nil {
+            return nil, err
+        }
+
+        return []Status{{ID: server.ID, IP: server.IP, Name: server.Name}}, nil
+    })
+}
+
+// removeAll destroys all servers created by this tool, or every server in the project if force-all is set, in
+// the background
+func (h *HTTP) removeAll(response http.ResponseWriter, request *http.Request) {
+    h.startJob(response, jobRemove, h.removeServers(request.URL.Query().Has("force-all")))
+}
+
+// removeServers returns work which destroys all servers created by this tool, or every server in the project if
+// forceAll is set
+func (h *HTTP) removeServers(forceAll bool) work {
+    list := vps.ListManagedVPS
+    if forceAll {
+        list = vps.ListActiveVPS
     }
 
-    for _, serverID := range active {
-        err = vps.Destroy(h.env, serverID)
+    return func(ctx context.Context, progress vps.Progress) ([]Status, error) {
+        progress.Report(vpn.StepLookup)
+        servers, err := list(ctx, h.env)
         if err != nil {
-            errorResponse(response, err)
-            return
+            return nil, err
         }
-    }
 
-    h.status(response, nil)
+        removed := make([]Status, 0, len(servers))
+        for _, server := range servers {
+            err = vpn.Remove(ctx, h.env, server, progress)
+            if err != nil {
+                return removed, err
+            }
+
+            removed = append(removed, Status{ID: server.ID, IP: server.IP, Name: server.Name})
+        }
+
+        return removed, nil
+    }
 }
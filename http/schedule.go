@@ -0,0 +1,161 @@
+package http
+
+import (
+    "log"
+    "sync"
+    "time"
+
+    "github.com/robfig/cron/v3"
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+type Schedule struct {
+    Create   *ScheduleEntry `json:"create,omitempty"`
+    Remove   *ScheduleEntry `json:"remove,omitempty"`
+    Timezone string         `json:"timezone"`
+}
+
+type ScheduleEntry struct {
+    Job      string     `json:"job,omitempty"`
+    Last     *time.Time `json:"last,omitempty"`
+    Next     time.Time  `json:"next"`
+    Schedule string     `json:"schedule"`
+}
+
+type scheduled struct {
+    id       cron.EntryID
+    job      string
+    last     time.Time
+    schedule string
+}
+
+type scheduler struct {
+    cron     *cron.Cron
+    entries  map[string]*scheduled
+    location *time.Location
+    mutex    sync.Mutex
+}
+
+// newScheduler creates a scheduler which runs jobs in the configured timezone
+func newScheduler(env env.Env) (*scheduler, error) {
+    location := time.Local
+    if env.Schedule.Timezone != "" {
+        var err error
+        location, err = time.LoadLocation(env.Schedule.Timezone)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return &scheduler{
+        cron:     cron.New(cron.WithLocation(location)),
+        entries:  make(map[string]*scheduled),
+        location: location,
+    }, nil
+}
+
+// add starts a job each time the schedule is due
+func (s *scheduler) add(jobType string, schedule string, start func() (Job, error)) error {
+    entry := &scheduled{schedule: schedule}
+
+    id, err := s.cron.AddFunc(schedule, func() {
+        log.Printf("Starting scheduled %s", jobType)
+        job, err := start()
+        if err != nil {
+            log.Printf("Unable to start scheduled %s: %v", jobType, err)
+            return
+        }
+
+        s.mutex.Lock()
+        defer s.mutex.Unlock()
+
+        entry.job = job.ID
+        entry.last = time.Now()
+    })
+    if err != nil {
+        return err
+    }
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    entry.id = id
+    s.entries[jobType] = entry
+
+    return nil
+}
+
+// entry returns the state of a scheduled job, or nil if the job isn't scheduled
+func (s *scheduler) entry(jobType string) *ScheduleEntry {
+    scheduled, found := s.entries[jobType]
+    if !found {
+        return nil
+    }
+
+    entry := &ScheduleEntry{
+        Job:      scheduled.job,
+        Next:     s.cron.Entry(scheduled.id).Next.In(s.location),
+        Schedule: scheduled.schedule,
+    }
+
+    if !scheduled.last.IsZero() {
+        last := scheduled.last.In(s.location)
+        entry.Last = &last
+    }
+
+    return entry
+}
+
+// status returns the state of each scheduled job
+func (s *scheduler) status() *Schedule {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    return &Schedule{
+        Create:   s.entry(jobCreate),
+        Remove:   s.entry(jobRemove),
+        Timezone: s.location.String(),
+    }
+}
+
+// schedule starts creating and removing servers at the configured times
+func (h *HTTP) schedule() error {
+    var err error
+    h.scheduler, err = newScheduler(h.env)
+    if err != nil {
+        return err
+    }
+
+    if h.env.Schedule.Create != "" {
+        err = h.scheduler.add(jobCreate, h.env.Schedule.Create, func() (Job, error) {
+            return h.jobs.start(jobCreate, h.createServer)
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    if h.env.Schedule.Remove != "" {
+        err = h.scheduler.add(jobRemove, h.env.Schedule.Remove, func() (Job, error) {
+            return h.jobs.start(jobRemove, h.removeServers(false))
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    h.scheduler.cron.Start()
+
+    status := h.scheduler.status()
+    logScheduled(jobCreate, status.Create)
+    logScheduled(jobRemove, status.Remove)
+
+    return nil
+}
+
+// logScheduled logs when a scheduled job will next run
+func logScheduled(jobType string, entry *ScheduleEntry) {
+    if entry != nil {
+        log.Printf("Scheduled %s '%s', next run at %s", jobType, entry.Schedule, entry.Next.Format(time.RFC3339))
+    }
+}
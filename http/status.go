@@ -1,39 +1,134 @@
 package http
 
 import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
     "net/http"
+    "time"
 
     "github.com/sjdaws/cloudserver-vpn/dns"
     "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/helpers"
+    "github.com/sjdaws/cloudserver-vpn/state"
     "github.com/sjdaws/cloudserver-vpn/vps"
 )
 
+type Overview struct {
+    Schedule *Schedule `json:"schedule,omitempty"`
+    Servers  []Status  `json:"servers"`
+}
+
 type Status struct {
-    DNS  bool   `json:"dns,omitempty"`
-    ID   int    `json:"id"`
-    IP   string `json:"ip"`
-    Name string `json:"name"`
+    DNS       bool       `json:"dns,omitempty"`
+    Expires   *time.Time `json:"expires,omitempty"`
+    ID        int        `json:"id"`
+    IP        string     `json:"ip"`
+    Name      string     `json:"name"`
+    Remaining string     `json:"remaining,omitempty"`
+}
+
+// get returns VPS and optionally DNS status for a single VPS
+func (h *HTTP) get(response http.ResponseWriter, request *http.Request) {
+    server, found := h.findServer(response, request)
+    if !found {
+        return
+    }
+
+    h.sendResponse(response, http.StatusOK, h.getStatus(request.Context(), []vps.VPS{*server})[0])
 }
 
-// status returns VPS and optionally DNS status for active VPS
-func (h *HTTP) status(response http.ResponseWriter, _ *http.Request) {
-    statuses, err := getVPSStatus(h.env)
+// list returns VPS and optionally DNS status for active VPS created by this tool
+func (h *HTTP) list(response http.ResponseWriter, request *http.Request) {
+    servers, err := vps.ListManagedVPS(request.Context(), h.env)
     if err != nil {
-        errorResponse(response, err)
+        h.errorResponse(response, err)
         return
     }
 
-    if h.env.Cloudflare.Zone != "" {
-        statuses = getDNSStatus(h.env, statuses)
+    h.sendResponse(response, http.StatusOK, h.getStatus(request.Context(), servers))
+}
+
+// status returns the status of active VPS created by this tool and the state of any schedule
+func (h *HTTP) status(response http.ResponseWriter, request *http.Request) {
+    servers, err := vps.ListManagedVPS(request.Context(), h.env)
+    if err != nil {
+        h.errorResponse(response, err)
+        return
     }
 
-    sendResponse(response, statuses)
+    overview := Overview{Servers: h.getStatus(request.Context(), servers)}
+    if h.scheduler != nil {
+        overview.Schedule = h.scheduler.status()
+    }
+
+    h.sendResponse(response, http.StatusOK, overview)
+}
+
+// getState returns the saved state of servers and operations
+func (h *HTTP) getState(response http.ResponseWriter, _ *http.Request) {
+    saved, err := state.Read(h.env)
+    if err != nil {
+        h.errorResponse(response, err)
+        return
+    }
+
+    h.sendResponse(response, http.StatusOK, saved)
+}
+
+// findServer finds the server for the id in the request path, sending a not found response if it doesn't exist.
+// Only servers created by this tool in the configured project are found unless force is set.
+func (h *HTTP) findServer(response http.ResponseWriter, request *http.Request) (*vps.VPS, bool) {
+    serverID := helpers.AtoI(request.PathValue("id"))
+    if serverID == 0 {
+        h.jsonError(response, http.StatusNotFound, fmt.Sprintf("server %s not found", request.PathValue("id")))
+        return nil, false
+    }
+
+    if request.URL.Query().Has("force") {
+        server, err := vps.Get(request.Context(), h.env, serverID)
+        if errors.Is(err, vps.ErrNotFound) {
+            h.jsonError(response, http.StatusNotFound, fmt.Sprintf("server %d not found", serverID))
+            return nil, false
+        }
+
+        if err != nil {
+            h.errorResponse(response, err)
+            return nil, false
+        }
+
+        return server, true
+    }
+
+    servers, err := vps.ListActiveVPS(request.Context(), h.env)
+    if err != nil {
+        h.errorResponse(response, err)
+        return nil, false
+    }
+
+    for _, server := range servers {
+        if server.ID != serverID {
+            continue
+        }
+
+        if !server.Managed {
+            h.jsonError(response, http.StatusForbidden, fmt.Sprintf("server %d was not created by this tool, use ?force to use it anyway", serverID))
+            return nil, false
+        }
+
+        return &server, true
+    }
+
+    h.jsonError(response, http.StatusNotFound, fmt.Sprintf("server %d not found in project", serverID))
+
+    return nil, false
 }
 
 // getDNSStatus resolves dns for specified VPS
-func getDNSStatus(env env.Env, statuses []Status) []Status {
+func getDNSStatus(ctx context.Context, env env.Env, statuses []Status) []Status {
     for id, status := range statuses {
-        content, _ := dns.Retrieve(env, status.Name)
+        content, _ := dns.Retrieve(ctx, env, status.Name)
         statuses[id].DNS = false
         if content == status.IP {
             statuses[id].DNS = true
@@ -43,29 +138,46 @@ func getDNSStatus(env env.Env, statuses []Status) []Status {
     return statuses
 }
 
-// getVPSStatus gets the status of active VPS
-func getVPSStatus(env env.Env) ([]Status, error) {
-    servers, err := vps.ListActiveVPS(env)
+// withCreated fills in when servers were created from the saved state if the provider doesn't report it
+func withCreated(env env.Env, servers []vps.VPS) []vps.VPS {
+    saved, err := state.Read(env)
     if err != nil {
-        return nil, err
+        log.Print(err)
+        return servers
     }
 
-    statuses := make([]Status, 0)
-    for _, server := range servers {
-        var ip string
-        for _, ipData := range server.IPs {
-            if ipData.Primary == true {
-                ip = ipData.IP
-                break
-            }
+    for i, server := range servers {
+        recorded := saved.Server(server.ID)
+        if server.Created.IsZero() && recorded != nil {
+            servers[i].Created = recorded.Created
         }
+    }
 
-        statuses = append(statuses, Status{
+    return servers
+}
+
+// getStatus gets the status of VPS, when they will expire and optionally their DNS
+func (h *HTTP) getStatus(ctx context.Context, servers []vps.VPS) []Status {
+    statuses := make([]Status, 0)
+    for _, server := range withCreated(h.env, servers) {
+        status := Status{
             ID:   server.ID,
-            IP:   ip,
+            IP:   server.IP,
             Name: server.Name,
-        })
+        }
+
+        expires := h.expiry.expires(server)
+        if !expires.IsZero() {
+            status.Expires = &expires
+            status.Remaining = max(time.Until(expires), 0).Round(time.Second).String()
+        }
+
+        statuses = append(statuses, status)
     }
 
-    return statuses, nil
+    if h.env.DNS.Provider != "" {
+        statuses = getDNSStatus(ctx, h.env, statuses)
+    }
+
+    return statuses
 }
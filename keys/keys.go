@@ -0,0 +1,60 @@
+package keys
+
+import (
+    "crypto/ecdh"
+    "crypto/rand"
+    "encoding/base64"
+    "fmt"
+)
+
+const keyLength = 32
+
+// Generate creates a new base64 encoded Curve25519 private key, clamped the same way as wg genkey
+func Generate() (string, error) {
+    private := make([]byte, keyLength)
+    _, err := rand.Read(private)
+    if err != nil {
+        return "", fmt.Errorf("unable to generate private key: %v", err)
+    }
+
+    private[0] &= 248
+    private[31] = (private[31] & 127) | 64
+
+    return base64.StdEncoding.EncodeToString(private), nil
+}
+
+// Public derives the base64 encoded Curve25519 public key for a base64 encoded private key
+func Public(privateKey string) (string, error) {
+    decoded, err := decode(privateKey)
+    if err != nil {
+        return "", err
+    }
+
+    private, err := ecdh.X25519().NewPrivateKey(decoded)
+    if err != nil {
+        return "", fmt.Errorf("unable to read private key: %v", err)
+    }
+
+    return base64.StdEncoding.EncodeToString(private.PublicKey().Bytes()), nil
+}
+
+// Valid determines whether a key is a base64 encoded 32 byte key
+func Valid(key string) bool {
+    _, err := decode(key)
+
+    return err == nil
+}
+
+// decode decodes a base64 encoded key and ensures it is the right length
+func decode(key string) ([]byte, error) {
+    decoded, err := base64.StdEncoding.DecodeString(key)
+    if err != nil {
+        return nil, fmt.Errorf("unable to decode key: %v", err)
+    }
+
+    if len(decoded) != keyLength {
+        return nil, fmt.Errorf("key must be %d bytes, found %d", keyLength, len(decoded))
+    }
+
+    return decoded, nil
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
+    "errors"
     "fmt"
+    "io"
     "log"
     "os"
+    "os/signal"
     "strings"
+    "syscall"
+    _ "time/tzdata"
 
-    "github.com/sjdaws/cloudserver-vpn/dns"
     "github.com/sjdaws/cloudserver-vpn/env"
     "github.com/sjdaws/cloudserver-vpn/helpers"
     "github.com/sjdaws/cloudserver-vpn/http"
+    "github.com/sjdaws/cloudserver-vpn/keys"
+    "github.com/sjdaws/cloudserver-vpn/redact"
+    "github.com/sjdaws/cloudserver-vpn/state"
+    "github.com/sjdaws/cloudserver-vpn/vpn"
     "github.com/sjdaws/cloudserver-vpn/vps"
+    "github.com/sjdaws/cloudserver-vpn/wireguard"
 )
 
 const usageText = `
@@ -20,82 +31,286 @@ Run a New Zealand based VPN on demand for only 1.5c per hour
 
 Options:
 
+  --config path  Read configuration from a YAML file, environment variables take precedence
   --create       Create a VPN server
-  --remove       Remove all created VPN servers
+  --genkey       Generate a WireGuard private key
+  --options      List the locations, operating systems and plans available
+  --pubkey       Derive a WireGuard public key from a private key read from stdin
+  --peers        Output a WireGuard client configuration for each peer
+  --peers id     Output the WireGuard client configuration for a single peer
+  --qr           Output a QR code of the client configuration for each peer
+  --qr id        Output a QR code of the client configuration for a single peer
+  --reconcile    Create, remove or update servers and DNS so a single server named SERVER_NAME is running
+  --remove       Remove all VPN servers created by this tool
   --remove id    Remove a single VPN server
+  --remove --force-all
+                 Remove all servers in the project, including those not created by this tool
   --serve        Create an HTTP server
+  --state        Output the saved state of servers and operations
 
 `
 
 func main() {
-    if len(os.Args) == 1 {
-        fmt.Printf(usageText, os.Args[0])
+    args, configPath := parseArgs(os.Args)
+    if len(args) == 1 {
+        fmt.Printf(usageText, args[0])
         os.Exit(0)
     }
 
-    config := env.Read()
+    config, err := env.Read(configPath)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    redactLogs(config)
+
+    // Stop waiting on the API if the command is interrupted
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
 
-    switch strings.ToLower(os.Args[1]) {
+    switch strings.ToLower(args[1]) {
     case "--create":
+        config = prepareWireguard(config)
+        defer lockOperations(config)()
+
         log.Print("Creating and configuring vps")
+        if config.Server.WaitTimeout > 0 {
+            log.Printf("Waiting up to %s for WireGuard to become reachable", config.Server.WaitTimeout)
+        }
 
-        server, err := vps.Create(config)
+        server, err := vpn.Create(ctx, config, logStep)
         if err != nil {
             log.Fatal(err)
         }
 
-        log.Printf("VPS created, ID: %d, IP: %s", server.ID, server.IP)
+        if server.Existing {
+            log.Printf("VPS already exists, ID: %d, IP: %s", server.ID, server.IP)
+        } else {
+            log.Printf("VPS created, ID: %d, IP: %s", server.ID, server.IP)
+        }
+        if config.DNS.Provider != "" {
+            log.Printf("DNS record %s configured", config.Server.FQDN)
+        }
 
-        if config.Cloudflare.Zone != "" {
-            log.Printf("Configuring DNS record %s", config.Server.FQDN)
+        log.Print("Completed successfully")
 
-            err = dns.Configure(config, server)
-            if err != nil {
-                log.Fatal(err)
+    case "--genkey":
+        privateKey, err := keys.Generate()
+        if err != nil {
+            log.Fatal(err)
+        }
+
+        fmt.Println(privateKey)
+
+    case "--options":
+        options, err := vps.ListOptions(ctx, config)
+        if err != nil {
+            log.Fatal(err)
+        }
+
+        printOptions("Locations (CLOUDSERVER_LOCATION)", options.Locations)
+        printOptions("Operating systems (CLOUDSERVER_OS)", options.OperatingSystems)
+        printOptions("Plans (CLOUDSERVER_PLAN)", options.Plans)
+
+    case "--peers", "--qr":
+        config = prepareWireguard(config)
+
+        configs, err := vpn.ClientConfigs(ctx, config)
+        if err != nil {
+            log.Fatal(err)
+        }
+
+        found := false
+        for _, client := range configs {
+            if len(args) == 3 && helpers.AtoI(args[2]) != client.ID {
+                continue
+            }
+
+            output := client.Config
+            if strings.ToLower(args[1]) == "--qr" {
+                output, err = client.Terminal()
+                // Skip peers which can't be scanned unless the peer was asked for
+                if errors.Is(err, wireguard.ErrNoPrivateKey) && len(args) != 3 {
+                    log.Print(err)
+                    continue
+                }
+
+                if err != nil {
+                    log.Fatal(err)
+                }
             }
 
-            log.Print("DNS configured")
+            if client.Name != "" {
+                fmt.Printf("# WIREGUARD_PEER%d (%s)\n%s\n", client.ID, client.Name, output)
+            } else {
+                fmt.Printf("# WIREGUARD_PEER%d\n%s\n", client.ID, output)
+            }
+            found = true
+        }
+
+        if !found {
+            log.Fatal("unable to find any matching peers")
+        }
+
+    case "--pubkey":
+        privateKey, err := io.ReadAll(os.Stdin)
+        if err != nil {
+            log.Fatalf("unable to read private key: %v", err)
+        }
+
+        publicKey, err := keys.Public(strings.TrimSpace(string(privateKey)))
+        if err != nil {
+            log.Fatal(err)
+        }
+
+        fmt.Println(publicKey)
+
+    case "--reconcile":
+        config = prepareWireguard(config)
+        defer lockOperations(config)()
+
+        server, err := vpn.Reconcile(ctx, config, logStep, func(action string) {
+            log.Print(action)
+        })
+        if err != nil {
+            log.Fatal(err)
         }
 
+        log.Printf("VPS %d is running at %s", server.ID, server.IP)
         log.Print("Completed successfully")
 
     case "--remove":
-        var active []int
-        var err error
+        defer lockOperations(config)()
 
-        if len(os.Args) == 3 {
-            active = []int{helpers.AtoI(os.Args[2])}
-        } else {
-            servers, err := vps.ListActiveVPS(config)
+        var active []vps.VPS
+
+        if len(args) == 3 && args[2] != "--force-all" {
+            server, err := vps.Get(ctx, config, helpers.AtoI(args[2]))
             if err != nil {
                 log.Fatal(err)
             }
 
-            for _, server := range servers {
-                active = append(active, server.ID)
+            active = []vps.VPS{*server}
+        } else {
+            list := vps.ListManagedVPS
+            if len(args) == 3 {
+                list = vps.ListActiveVPS
+            }
+
+            servers, err := list(ctx, config)
+            if err != nil {
+                log.Fatal(err)
             }
 
+            active = servers
+
             log.Printf("Found %d server(s) to clean up", len(active))
         }
 
-        for _, serverID := range active {
-            log.Printf("Removing server %d", serverID)
+        for _, server := range active {
+            log.Printf("Removing server %d", server.ID)
 
-            err = vps.Destroy(config, serverID)
+            err := vpn.Remove(ctx, config, server, logStep)
             if err != nil {
                 log.Fatal(err)
             }
 
-            log.Printf("Server %d removed", serverID)
+            log.Printf("Server %d removed", server.ID)
         }
 
         log.Print("Completed successfully")
 
     case "--serve":
+        config = prepareWireguard(config)
+
         server := http.New(config)
         err := server.Start()
         if err != nil {
             log.Fatalf("unable to start http server: %v", err)
         }
+
+    case "--state":
+        saved, err := state.Read(config)
+        if err != nil {
+            log.Fatal(err)
+        }
+
+        output, err := json.MarshalIndent(saved, "", "  ")
+        if err != nil {
+            log.Fatalf("unable to marshal state: %v", err)
+        }
+
+        fmt.Println(string(output))
+    }
+}
+
+// lockOperations waits for any create, remove or reconcile running in another process, such as --serve, to finish
+// and returns a function which releases the lock
+func lockOperations(config env.Env) func() {
+    unlock, err := state.LockOperations(config)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    return unlock
+}
+
+// logStep logs the start of each step while creating or removing a server
+func logStep(step string) {
+    log.Printf("Starting %s", step)
+}
+
+// parseArgs removes the config file option from the arguments and returns the config file path
+func parseArgs(original []string) ([]string, string) {
+    var args []string
+    var configPath string
+
+    for i := 0; i < len(original); i++ {
+        if strings.ToLower(original[i]) == "--config" && i+1 < len(original) {
+            configPath = original[i+1]
+            i++
+            continue
+        }
+
+        args = append(args, original[i])
+    }
+
+    return args, configPath
+}
+
+// prepareWireguard loads or generates the WireGuard private key if one isn't configured and allocates peer addresses
+func prepareWireguard(config env.Env) env.Env {
+    generated := config.Wireguard.Interface.PrivateKey == ""
+
+    config, err := wireguard.EnsurePrivateKey(config)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    if generated {
+        log.Printf("Using WireGuard private key from %s", wireguard.PrivateKeyPath(config))
+    }
+
+    config, err = wireguard.AllocatePeers(config)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    redactLogs(config)
+
+    return config
+}
+
+// redactLogs removes secrets from everything that is logged
+func redactLogs(config env.Env) {
+    log.SetOutput(redact.New(config.Secrets()...).Writer(os.Stderr))
+}
+
+// printOptions prints a list of options with their ids
+func printOptions(title string, options []vps.Option) {
+    fmt.Printf("%s:\n", title)
+    for _, option := range options {
+        fmt.Printf("  %-6d %s\n", option.ID, option.Name)
     }
+    fmt.Println()
 }
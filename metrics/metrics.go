@@ -0,0 +1,165 @@
+package metrics
+
+import (
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Server struct {
+    Created time.Time
+    ID      int
+    Name    string
+}
+
+type transport struct {
+    api  string
+    base http.RoundTripper
+}
+
+const namespace = "cloudserver_vpn"
+
+var (
+    apiDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Help:      "Duration of API calls to each provider in seconds.",
+        Name:      "api_request_duration_seconds",
+        Namespace: namespace,
+    }, []string{"api", "method", "endpoint"})
+    apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Help:      "Number of API calls to each provider by endpoint and status code.",
+        Name:      "api_requests_total",
+        Namespace: namespace,
+    }, []string{"api", "method", "endpoint", "code"})
+    httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Help:      "Duration of HTTP requests served in seconds.",
+        Name:      "http_request_duration_seconds",
+        Namespace: namespace,
+    }, []string{"method", "route"})
+    httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Help:      "Number of HTTP requests served by route and status code.",
+        Name:      "http_requests_total",
+        Namespace: namespace,
+    }, []string{"method", "route", "code"})
+    operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1200},
+        Help:      "Duration of server create and remove operations in seconds.",
+        Name:      "operation_duration_seconds",
+        Namespace: namespace,
+    }, []string{"operation", "result"})
+    serverUptime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Help:      "Number of seconds each active server has been running.",
+        Name:      "server_uptime_seconds",
+        Namespace: namespace,
+    }, []string{"id", "name"})
+    servers = prometheus.NewGauge(prometheus.GaugeOpts{
+        Help:      "Number of active servers created by this tool.",
+        Name:      "servers",
+        Namespace: namespace,
+    })
+    spend = prometheus.NewGauge(prometheus.GaugeOpts{
+        Help:      "Estimated spend in dollars for every server in the saved state, including removed servers which have been pruned.",
+        Name:      "estimated_spend_dollars",
+        Namespace: namespace,
+    })
+
+    // identifiers matches path segments which identify a single resource so they can be grouped
+    identifiers = regexp.MustCompile(`^([0-9]+|[0-9a-f]{32})$`)
+)
+
+func init() {
+    prometheus.MustRegister(apiDuration, apiRequests, httpDuration, httpRequests, operationDuration, serverUptime, servers, spend)
+}
+
+// Handler serves metrics in the Prometheus exposition format
+func Handler() http.Handler {
+    return promhttp.Handler()
+}
+
+// Instrument records metrics for each request served by a mux, grouped by the pattern the request matched
+func Instrument(mux *http.ServeMux) http.Handler {
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        _, pattern := mux.Handler(request)
+        route := strings.TrimPrefix(pattern, request.Method+" ")
+        if route == "" {
+            route = "unmatched"
+        }
+
+        recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+        started := time.Now()
+
+        mux.ServeHTTP(recorder, request)
+
+        httpDuration.WithLabelValues(request.Method, route).Observe(time.Since(started).Seconds())
+        httpRequests.WithLabelValues(request.Method, route, strconv.Itoa(recorder.status)).Inc()
+    })
+}
+
+// ObserveOperation records how long a create or remove took and whether it succeeded
+func ObserveOperation(operation string, started time.Time, err error) {
+    result := "success"
+    if err != nil {
+        result = "failure"
+    }
+
+    operationDuration.WithLabelValues(operation, result).Observe(time.Since(started).Seconds())
+}
+
+// SetServers records the active servers and their uptime
+func SetServers(active []Server) {
+    serverUptime.Reset()
+    for _, server := range active {
+        if !server.Created.IsZero() {
+            serverUptime.WithLabelValues(strconv.Itoa(server.ID), server.Name).Set(time.Since(server.Created).Seconds())
+        }
+    }
+
+    servers.Set(float64(len(active)))
+}
+
+// SetSpend records the estimated spend in dollars
+func SetSpend(dollars float64) {
+    spend.Set(dollars)
+}
+
+// Transport records metrics for each API call made through a round tripper
+func Transport(api string, base http.RoundTripper) http.RoundTripper {
+    return &transport{
+        api:  api,
+        base: base,
+    }
+}
+
+// RoundTrip performs a request and records its duration and status code
+func (t *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+    endpoint := endpoint(request.URL.Path)
+    started := time.Now()
+
+    response, err := t.base.RoundTrip(request)
+
+    apiDuration.WithLabelValues(t.api, request.Method, endpoint).Observe(time.Since(started).Seconds())
+
+    code := "error"
+    if err == nil {
+        code = strconv.Itoa(response.StatusCode)
+    }
+    apiRequests.WithLabelValues(t.api, request.Method, endpoint, code).Inc()
+
+    return response, err
+}
+
+// endpoint replaces identifiers in a path so requests for different resources are grouped together
+func endpoint(path string) string {
+    segments := strings.Split(path, "/")
+    for i, segment := range segments {
+        if identifiers.MatchString(segment) {
+            segments[i] = "{id}"
+        }
+    }
+
+    return strings.Join(segments, "/")
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import "net/http"
+
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+// WriteHeader records the status code before writing it
+func (r *statusRecorder) WriteHeader(status int) {
+    r.status = status
+    r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the original response writer so http.ResponseController can flush streamed responses
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+    return r.ResponseWriter
+}
@@ -0,0 +1,65 @@
+package redact
+
+import (
+    "errors"
+    "io"
+    "strings"
+)
+
+type Redactor struct {
+    replacer *strings.Replacer
+}
+
+type writer struct {
+    redactor *Redactor
+    writer   io.Writer
+}
+
+const replacement = "[redacted]"
+
+// New creates a redactor which replaces each secret with a placeholder
+func New(secrets ...string) *Redactor {
+    var pairs []string
+    for _, secret := range secrets {
+        if secret != "" {
+            pairs = append(pairs, secret, replacement)
+        }
+    }
+
+    return &Redactor{
+        replacer: strings.NewReplacer(pairs...),
+    }
+}
+
+// Error returns an error with any secrets removed from the message
+func (r *Redactor) Error(err error) error {
+    if err == nil {
+        return nil
+    }
+
+    return errors.New(r.String(err.Error()))
+}
+
+// String removes any secrets from a string
+func (r *Redactor) String(original string) string {
+    return r.replacer.Replace(original)
+}
+
+// Writer wraps a writer so secrets are removed before anything is written, each write should be a
+// complete message, such as a log line, so secrets can't be split across writes
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+    return &writer{
+        redactor: r,
+        writer:   w,
+    }
+}
+
+// Write removes secrets and writes to the underlying writer
+func (w *writer) Write(p []byte) (int, error) {
+    _, err := io.WriteString(w.writer, w.redactor.String(string(p)))
+    if err != nil {
+        return 0, err
+    }
+
+    return len(p), nil
+}
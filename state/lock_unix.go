@@ -0,0 +1,18 @@
+//go:build unix
+
+package state
+
+import (
+    "os"
+    "syscall"
+)
+
+// lockFile takes an exclusive lock on an open file, waiting until any other process releases it
+func lockFile(file *os.File) error {
+    return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
+
+// unlockFile releases a lock taken by lockFile
+func unlockFile(file *os.File) error {
+    return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package state
+
+import (
+    "os"
+
+    "golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on an open file, waiting until any other process releases it
+func lockFile(file *os.File) error {
+    return windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
+
+// unlockFile releases a lock taken by lockFile
+func unlockFile(file *os.File) error {
+    return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
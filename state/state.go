@@ -0,0 +1,264 @@
+package state
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+type Event struct {
+    Error string    `json:"error,omitempty"`
+    Time  time.Time `json:"time"`
+    Type  string    `json:"type"`
+}
+
+type Operation struct {
+    Error    string    `json:"error,omitempty"`
+    Finished time.Time `json:"finished"`
+    ServerID int       `json:"serverId,omitempty"`
+    Started  time.Time `json:"started"`
+    Type     string    `json:"type"`
+}
+
+type Peer struct {
+    AllowedIPs string `json:"allowedIps"`
+    ID         int    `json:"id"`
+    Name       string `json:"name,omitempty"`
+    PublicKey  string `json:"publicKey"`
+}
+
+type Server struct {
+    ConfigHash string     `json:"configHash"`
+    Created    time.Time  `json:"created"`
+    Events     []Event    `json:"events"`
+    FQDN       string     `json:"fqdn"`
+    ID         int        `json:"id"`
+    IP         string     `json:"ip"`
+    Peers      []Peer     `json:"peers"`
+    Removed    *time.Time `json:"removed,omitempty"`
+}
+
+type State struct {
+    Operations  []Operation `json:"operations"`
+    PrunedHours float64     `json:"prunedHours"`
+    Servers     []Server    `json:"servers"`
+}
+
+const (
+    EventCreated     = "created"
+    EventDNS         = "dns configured"
+    EventDNSRemoved  = "dns removed"
+    EventExisting    = "create requested for existing server"
+    EventRemoveError = "remove failed"
+    EventRemoved     = "removed"
+    maxOperations    = 100
+    maxRemoved       = 100
+    operationsFile   = "operations.lock"
+    stateFile        = "state.json"
+)
+
+// mutex serialises changes to the state file within this process, the lock file serialises them between processes
+var mutex sync.Mutex
+
+// LockOperations waits for any create, remove or reconcile running in another process to finish and stops another
+// one starting until the returned function is called
+func LockOperations(env env.Env) (func(), error) {
+    unlock, err := lock(filepath.Join(env.Data.Path, operationsFile))
+    if err != nil {
+        return nil, fmt.Errorf("unable to lock operations: %v", err)
+    }
+
+    return unlock, nil
+}
+
+// Path returns the path the state is saved to
+func Path(env env.Env) string {
+    return filepath.Join(env.Data.Path, stateFile)
+}
+
+// Read loads the state from the data path, returning an empty state if nothing has been saved
+func Read(env env.Env) (State, error) {
+    mutex.Lock()
+    defer mutex.Unlock()
+
+    return read(Path(env))
+}
+
+// Update loads the state, applies a change and saves it
+func Update(env env.Env, change func(state *State)) error {
+    mutex.Lock()
+    defer mutex.Unlock()
+
+    path := Path(env)
+
+    unlock, err := lock(path + ".lock")
+    if err != nil {
+        return fmt.Errorf("unable to lock state: %v", err)
+    }
+    defer unlock()
+
+    state, err := read(path)
+    if err != nil {
+        return err
+    }
+
+    change(&state)
+    state.prune()
+
+    return write(path, state)
+}
+
+// AddEvent records a lifecycle event for a server
+func (s *State) AddEvent(serverID int, event Event) {
+    server := s.Server(serverID)
+    if server != nil {
+        server.Events = append(server.Events, event)
+    }
+}
+
+// AddOperation records a create or remove operation
+func (s *State) AddOperation(operation Operation) {
+    s.Operations = append(s.Operations, operation)
+}
+
+// Server returns the recorded server with an id, or nil if it hasn't been recorded
+func (s *State) Server(serverID int) *Server {
+    for i := range s.Servers {
+        if s.Servers[i].ID == serverID {
+            return &s.Servers[i]
+        }
+    }
+
+    return nil
+}
+
+// SetServer records a server, replacing any existing record with the same id
+func (s *State) SetServer(server Server) {
+    existing := s.Server(server.ID)
+    if existing != nil {
+        *existing = server
+        return
+    }
+
+    s.Servers = append(s.Servers, server)
+}
+
+// prune removes the oldest operations and removed servers once there are too many, adding the hours removed servers
+// ran for to the pruned hours
+func (s *State) prune() {
+    if len(s.Operations) > maxOperations {
+        s.Operations = s.Operations[len(s.Operations)-maxOperations:]
+    }
+
+    removed := 0
+    for i := len(s.Servers) - 1; i >= 0; i-- {
+        if s.Servers[i].Removed == nil {
+            continue
+        }
+
+        removed++
+        if removed <= maxRemoved {
+            continue
+        }
+
+        // Keep the hours pruned servers ran for so the estimated spend never drops
+        if !s.Servers[i].Created.IsZero() {
+            s.PrunedHours += s.Servers[i].Removed.Sub(s.Servers[i].Created).Hours()
+        }
+
+        s.Servers = append(s.Servers[:i], s.Servers[i+1:]...)
+    }
+}
+
+// lock takes an exclusive lock on a lock file so the cli and http server exclude each other, waiting until any
+// other process releases it
+func lock(path string) (func(), error) {
+    err := os.MkdirAll(filepath.Dir(path), 0700)
+    if err != nil {
+        return nil, fmt.Errorf("unable to create data path %s: %v", filepath.Dir(path), err)
+    }
+
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+    if err != nil {
+        return nil, err
+    }
+
+    err = lockFile(file)
+    if err != nil {
+        _ = file.Close()
+        return nil, err
+    }
+
+    return func() {
+        _ = unlockFile(file)
+        _ = file.Close()
+    }, nil
+}
+
+// read loads the state from a file
+func read(path string) (State, error) {
+    state := State{
+        Operations: make([]Operation, 0),
+        Servers:    make([]Server, 0),
+    }
+
+    contents, err := os.ReadFile(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return state, nil
+    }
+
+    if err != nil {
+        return state, fmt.Errorf("unable to read state from %s: %v", path, err)
+    }
+
+    err = json.Unmarshal(contents, &state)
+    if err != nil {
+        return state, fmt.Errorf("unable to read state from %s: %v", path, err)
+    }
+
+    return state, nil
+}
+
+// write saves the state to a file, replacing it atomically so a crash can't leave a partial file
+func write(path string, state State) error {
+    contents, err := json.MarshalIndent(state, "", "  ")
+    if err != nil {
+        return fmt.Errorf("unable to marshal state: %v", err)
+    }
+
+    err = os.MkdirAll(filepath.Dir(path), 0700)
+    if err != nil {
+        return fmt.Errorf("unable to create data path %s: %v", filepath.Dir(path), err)
+    }
+
+    temporary, err := os.CreateTemp(filepath.Dir(path), stateFile+".*.tmp")
+    if err != nil {
+        return fmt.Errorf("unable to save state to %s: %v", path, err)
+    }
+    defer func() {
+        _ = os.Remove(temporary.Name())
+    }()
+
+    _, err = temporary.Write(contents)
+    if closeErr := temporary.Close(); err == nil {
+        err = closeErr
+    }
+
+    if err != nil {
+        return fmt.Errorf("unable to save state to %s: %v", temporary.Name(), err)
+    }
+
+    err = os.Rename(temporary.Name(), path)
+    if err != nil {
+        return fmt.Errorf("unable to save state to %s: %v", path, err)
+    }
+
+    return nil
+}
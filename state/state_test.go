@@ -0,0 +1,44 @@
+package state
+
+import (
+    "math"
+    "testing"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+func TestUpdateKeepsPrunedHours(t *testing.T) {
+    var e env.Env
+    e.Data.Path = t.TempDir()
+
+    created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    removed := created.Add(2 * time.Hour)
+
+    err := Update(e, func(state *State) {
+        for id := 1; id <= maxRemoved+2; id++ {
+            state.SetServer(Server{Created: created, ID: id, Removed: &removed})
+        }
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    saved, err := Read(e)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if len(saved.Servers) != maxRemoved {
+        t.Errorf("expected %d removed servers to be kept, got %d", maxRemoved, len(saved.Servers))
+    }
+
+    if saved.Server(1) != nil || saved.Server(2) != nil {
+        t.Error("expected the oldest removed servers to be pruned")
+    }
+
+    // The two pruned servers ran for two hours each
+    if math.Abs(saved.PrunedHours-4) > 1e-9 {
+        t.Errorf("expected 4 pruned hours, got %g", saved.PrunedHours)
+    }
+}
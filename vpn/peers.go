@@ -0,0 +1,71 @@
+package vpn
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+    "github.com/sjdaws/cloudserver-vpn/wireguard"
+)
+
+// ClientConfigs generates a client configuration for each peer which connects to the server named SERVER_NAME
+func ClientConfigs(ctx context.Context, env env.Env) ([]wireguard.ClientConfig, error) {
+    err := validateClientEnv(env)
+    if err != nil {
+        return nil, err
+    }
+
+    host, err := Endpoint(ctx, env)
+    if err != nil {
+        return nil, err
+    }
+
+    return wireguard.ClientConfigs(env, host)
+}
+
+// Endpoint returns the host peers should connect to, which is the FQDN if DNS is managed otherwise the server IP
+func Endpoint(ctx context.Context, env env.Env) (string, error) {
+    if env.DNS.Provider != "" {
+        return env.Server.FQDN, nil
+    }
+
+    servers, err := vps.ListManagedVPS(ctx, env)
+    if err != nil {
+        return "", err
+    }
+
+    for _, server := range servers {
+        if strings.EqualFold(server.Name, env.Server.FQDN) {
+            return server.IP, nil
+        }
+    }
+
+    return "", fmt.Errorf("unable to find server %s to use as an endpoint, it may need to be created", env.Server.FQDN)
+}
+
+// ServerClientConfigs generates a client configuration for each peer which connects to a specific server
+func ServerClientConfigs(env env.Env, server *vps.VPS) ([]wireguard.ClientConfig, error) {
+    err := validateClientEnv(env)
+    if err != nil {
+        return nil, err
+    }
+
+    host := server.IP
+    if env.DNS.Provider != "" && strings.EqualFold(server.Name, env.Server.FQDN) {
+        host = env.Server.FQDN
+    }
+
+    return wireguard.ClientConfigs(env, host)
+}
+
+// validateClientEnv ensures all the information required to generate client configurations is specified
+func validateClientEnv(env env.Env) error {
+    errs := env.ValidateCreateEnv()
+    if len(errs) > 0 {
+        return fmt.Errorf("unable to generate client configuration:\n - %s", strings.Join(errs, "\n - "))
+    }
+
+    return nil
+}
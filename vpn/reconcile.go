@@ -0,0 +1,102 @@
+package vpn
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/sjdaws/cloudserver-vpn/dns"
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/state"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+)
+
+type outdatedServer struct {
+    reason string
+    server vps.VPS
+}
+
+const (
+    StepDNSCheck = "dns check"
+    StepLookup   = "server lookup"
+)
+
+// Reconcile ensures a single server named SERVER_NAME exists with the current configuration and that its DNS record
+// points to it, reporting each corrective action taken
+func Reconcile(ctx context.Context, env env.Env, progress vps.Progress, report func(action string)) (*vps.VPS, error) {
+    errs := env.ValidateCreateEnv()
+    if len(errs) > 0 {
+        return nil, fmt.Errorf("unable to reconcile servers:\n - %s", strings.Join(errs, "\n - "))
+    }
+
+    progress.Report(StepLookup)
+    servers, err := vps.ListManagedVPS(ctx, env)
+    if err != nil {
+        return nil, err
+    }
+
+    saved, err := state.Read(env)
+    if err != nil {
+        return nil, err
+    }
+
+    hash := configHash(env)
+
+    var desired *vps.VPS
+    var outdated []outdatedServer
+    for _, server := range servers {
+        recorded := saved.Server(server.ID)
+
+        switch {
+        case !strings.EqualFold(server.Name, env.Server.FQDN):
+            outdated = append(outdated, outdatedServer{reason: fmt.Sprintf("it is not named %s", env.Server.FQDN), server: server})
+        case recorded != nil && recorded.ConfigHash != "" && recorded.ConfigHash != hash:
+            outdated = append(outdated, outdatedServer{reason: "it was built with a different configuration", server: server})
+        case desired != nil:
+            outdated = append(outdated, outdatedServer{reason: fmt.Sprintf("server %d is already named %s", desired.ID, env.Server.FQDN), server: server})
+        default:
+            desired = &server
+        }
+    }
+
+    // Outdated servers keep running until their replacement is ready and DNS points to it, so the VPN isn't down while
+    // reconciling
+    if desired == nil {
+        report(fmt.Sprintf("Creating server %s because one with the current configuration doesn't exist", env.Server.FQDN))
+        desired, err = create(ctx, env, progress, vps.Replace)
+        if err != nil {
+            return desired, err
+        }
+    }
+
+    if env.DNS.Provider != "" {
+        progress.Report(StepDNSCheck)
+        content, err := dns.Retrieve(ctx, env, env.Server.FQDN)
+        if err != nil && !errors.Is(err, dns.ErrNotFound) {
+            return desired, err
+        }
+
+        if content != desired.IP {
+            report(fmt.Sprintf("Pointing DNS record %s to %s instead of '%s'", env.Server.FQDN, desired.IP, content))
+
+            progress.Report(StepDNS)
+            err = dns.Configure(ctx, env, desired)
+            if err != nil {
+                return desired, err
+            }
+
+            recordEvent(env, desired.ID, state.EventDNS, nil)
+        }
+    }
+
+    for _, stale := range outdated {
+        report(fmt.Sprintf("Removing server %d (%s) because %s", stale.server.ID, stale.server.Name, stale.reason))
+        err = Remove(ctx, env, stale.server, progress)
+        if err != nil {
+            return desired, err
+        }
+    }
+
+    return desired, nil
+}
@@ -0,0 +1,130 @@
+package vpn
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/metrics"
+    "github.com/sjdaws/cloudserver-vpn/redact"
+    "github.com/sjdaws/cloudserver-vpn/state"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+    "github.com/sjdaws/cloudserver-vpn/wireguard"
+)
+
+// configHash summarises the configuration a server is built with so changes can be detected
+func configHash(env env.Env) string {
+    config := fmt.Sprintf(
+        "%s\n%d\n%d\n%d\n%s\n%s",
+        env.VPS.Provider,
+        env.CloudServer.Location,
+        env.CloudServer.OS,
+        env.CloudServer.Plan,
+        env.Server.FQDN,
+        wireguard.EncodedServerConfig(env),
+    )
+    sum := sha256.Sum256([]byte(config))
+
+    return hex.EncodeToString(sum[:])
+}
+
+// errorMessage returns an error message with any secrets removed so it can be saved
+func errorMessage(env env.Env, err error) string {
+    if err == nil {
+        return ""
+    }
+
+    return redact.New(env.Secrets()...).String(err.Error())
+}
+
+// recordCreated saves a server which was created, or records that an existing server was returned
+func recordCreated(env env.Env, server vps.VPS) {
+    updateState(env, func(current *state.State) {
+        now := time.Now()
+
+        if server.Existing && current.Server(server.ID) != nil {
+            current.AddEvent(server.ID, state.Event{Time: now, Type: state.EventExisting})
+            return
+        }
+
+        created := server.Created
+        if created.IsZero() {
+            created = now
+        }
+
+        peers := make([]state.Peer, 0, len(env.Wireguard.Peers))
+        for _, peer := range env.Wireguard.Peers {
+            peers = append(peers, state.Peer{AllowedIPs: peer.AllowedIPs, ID: peer.ID, Name: peer.Name, PublicKey: peer.PublicKey})
+        }
+
+        event := state.EventCreated
+        if server.Existing {
+            event = state.EventExisting
+        }
+
+        current.SetServer(state.Server{
+            ConfigHash: configHash(env),
+            Created:    created,
+            Events:     []state.Event{{Time: now, Type: event}},
+            FQDN:       env.Server.FQDN,
+            ID:         server.ID,
+            IP:         server.IP,
+            Peers:      peers,
+        })
+    })
+}
+
+// recordEvent saves a lifecycle event for a server
+func recordEvent(env env.Env, serverID int, event string, err error) {
+    updateState(env, func(current *state.State) {
+        current.AddEvent(serverID, state.Event{Error: errorMessage(env, err), Time: time.Now(), Type: event})
+    })
+}
+
+// recordOperation saves the outcome of a create or remove
+func recordOperation(env env.Env, operation string, serverID int, started time.Time, err error) {
+    metrics.ObserveOperation(operation, started, err)
+
+    updateState(env, func(current *state.State) {
+        current.AddOperation(state.Operation{
+            Error:    errorMessage(env, err),
+            Finished: time.Now(),
+            ServerID: serverID,
+            Started:  started,
+            Type:     operation,
+        })
+    })
+}
+
+// recordRemoved marks a server as removed, saving it first if it was created before state was recorded
+func recordRemoved(env env.Env, server vps.VPS) {
+    updateState(env, func(current *state.State) {
+        now := time.Now()
+
+        if current.Server(server.ID) == nil {
+            current.SetServer(state.Server{
+                Created: server.Created,
+                Events:  make([]state.Event, 0),
+                FQDN:    server.Name,
+                ID:      server.ID,
+                IP:      server.IP,
+                Peers:   make([]state.Peer, 0),
+            })
+        }
+
+        current.AddEvent(server.ID, state.Event{Time: now, Type: state.EventRemoved})
+        current.Server(server.ID).Removed = &now
+    })
+}
+
+// updateState applies a change to the saved state, failures are logged rather than returned so they don't
+// interrupt creating or removing a server
+func updateState(env env.Env, change func(current *state.State)) {
+    err := state.Update(env, change)
+    if err != nil {
+        log.Printf("unable to record state: %v", err)
+    }
+}
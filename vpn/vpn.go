@@ -0,0 +1,82 @@
+package vpn
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/dns"
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/state"
+    "github.com/sjdaws/cloudserver-vpn/vps"
+)
+
+const (
+    StepDNS       = "dns"
+    StepDNSRemove = "dns remove"
+    StepDestroy   = "server destroy"
+)
+
+// Create a server and configure DNS for it, reporting progress of each step. If DNS can't be configured the server
+// which was created is returned with the error.
+func Create(ctx context.Context, env env.Env, progress vps.Progress) (*vps.VPS, error) {
+    return create(ctx, env, progress, vps.Create)
+}
+
+// create a server using build and configure DNS for it
+func create(ctx context.Context, env env.Env, progress vps.Progress, build func(context.Context, env.Env, vps.Progress) (*vps.VPS, error)) (*vps.VPS, error) {
+    started := time.Now()
+
+    server, err := build(ctx, env, progress)
+    if err != nil {
+        recordOperation(env, "create", 0, started, err)
+        return nil, err
+    }
+
+    recordCreated(env, *server)
+
+    if env.DNS.Provider != "" {
+        progress.Report(StepDNS)
+        err = dns.Configure(ctx, env, server)
+        if err != nil {
+            recordOperation(env, "create", server.ID, started, err)
+            return server, fmt.Errorf("server %d was created but dns could not be configured, remove it with --remove %d: %w", server.ID, server.ID, err)
+        }
+
+        recordEvent(env, server.ID, state.EventDNS, nil)
+    }
+
+    recordOperation(env, "create", server.ID, started, nil)
+
+    return server, nil
+}
+
+// Remove a server and its DNS record, reporting progress of each step
+func Remove(ctx context.Context, env env.Env, server vps.VPS, progress vps.Progress) error {
+    started := time.Now()
+
+    progress.Report(StepDestroy)
+    err := vps.Destroy(ctx, env, server.ID)
+    if err != nil {
+        recordEvent(env, server.ID, state.EventRemoveError, err)
+        recordOperation(env, "remove", server.ID, started, err)
+        return err
+    }
+
+    recordRemoved(env, server)
+
+    if env.DNS.Provider != "" {
+        progress.Report(StepDNSRemove)
+        err = dns.Remove(ctx, env, &server)
+        if err != nil {
+            recordOperation(env, "remove", server.ID, started, err)
+            return err
+        }
+
+        recordEvent(env, server.ID, state.EventDNSRemoved, nil)
+    }
+
+    recordOperation(env, "remove", server.ID, started, nil)
+
+    return nil
+}
@@ -0,0 +1,275 @@
+package vps
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math/rand"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/metrics"
+)
+
+// APIError is returned when the API responds with an unexpected status
+type APIError struct {
+    Body       string
+    Message    string
+    Method     string
+    Path       string
+    Status     string
+    StatusCode int
+}
+
+// Client makes requests to the cloudserver.nz API
+type Client struct {
+    apiKey  string
+    baseURL string
+    client  *http.Client
+    mutex   sync.Mutex
+    resume  time.Time
+}
+
+type apiErrorBody struct {
+    Message string `json:"message"`
+}
+
+const (
+    clientTimeout = 30 * time.Second
+    maxAttempts   = 5
+    maxBackoff    = 30 * time.Second
+    minBackoff    = 500 * time.Millisecond
+)
+
+// NewClient creates a client for the API at baseURL which authenticates with an API key
+func NewClient(baseURL string, apiKey string) *Client {
+    return &Client{
+        apiKey:  apiKey,
+        baseURL: strings.TrimSuffix(baseURL, "/"),
+        client: &http.Client{
+            Timeout:   clientTimeout,
+            Transport: metrics.Transport(cloudServerProvider, http.DefaultTransport),
+        },
+    }
+}
+
+// Do performs a request, encoding payload as the JSON body if it isn't nil and decoding the JSON response into
+// result if it isn't nil. Requests which fail are retried with exponential backoff if they are safe to repeat.
+func (c *Client) Do(ctx context.Context, method string, path string, payload any, expected int, result any) error {
+    var body []byte
+    if payload != nil {
+        var err error
+        body, err = json.Marshal(payload)
+        if err != nil {
+            return fmt.Errorf("unable to marshal request: %v", err)
+        }
+    }
+
+    // Whether an earlier attempt may have been processed even though it failed
+    processed := false
+
+    for attempt := 1; ; attempt++ {
+        err := c.waitForRateLimit(ctx)
+        if err != nil {
+            return err
+        }
+
+        contents, response, err := c.send(ctx, method, path, body)
+
+        delay, retry := c.retryDelay(ctx, method, response, err, attempt)
+        if !retry {
+            if err != nil {
+                return err
+            }
+
+            // A delete which can't find what it's removing was completed by an earlier attempt
+            if processed && method == http.MethodDelete && response.StatusCode == http.StatusNotFound {
+                return nil
+            }
+
+            return c.decode(method, path, response, contents, expected, result)
+        }
+
+        if err != nil || response.StatusCode >= http.StatusInternalServerError {
+            processed = true
+        }
+
+        err = sleep(ctx, delay)
+        if err != nil {
+            return err
+        }
+    }
+}
+
+// Error describes the status and message returned by the API
+func (e *APIError) Error() string {
+    message := e.Message
+    if message == "" {
+        message = e.Body
+    }
+
+    return fmt.Sprintf("invalid status: %s - %s", e.Status, message)
+}
+
+// decode checks the status of a response and unmarshals the body
+func (c *Client) decode(method string, path string, response *http.Response, contents []byte, expected int, result any) error {
+    if response.StatusCode != expected {
+        apiErr := &APIError{
+            Body:       string(contents),
+            Method:     method,
+            Path:       path,
+            Status:     response.Status,
+            StatusCode: response.StatusCode,
+        }
+
+        var message apiErrorBody
+        if json.Unmarshal(contents, &message) == nil {
+            apiErr.Message = message.Message
+        }
+
+        return apiErr
+    }
+
+    if result == nil {
+        return nil
+    }
+
+    err := json.Unmarshal(contents, result)
+    if err != nil {
+        return fmt.Errorf("error reading response from server: %v", err)
+    }
+
+    return nil
+}
+
+// retryDelay determines whether a request should be retried and how long to wait first
+func (c *Client) retryDelay(ctx context.Context, method string, response *http.Response, err error, attempt int) (time.Duration, bool) {
+    // Client timeouts are reported as deadline exceeded as well, so only the context decides whether to give up
+    if attempt >= maxAttempts || ctx.Err() != nil {
+        return 0, false
+    }
+
+    backoff := min(minBackoff<<(attempt-1), maxBackoff)
+    backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+    // Requests which weren't processed because of rate limiting can always be retried
+    if response != nil && response.StatusCode == http.StatusTooManyRequests {
+        wait, found := rateLimitDelay(response.Header)
+        if found {
+            return min(wait, maxBackoff), true
+        }
+
+        return backoff, true
+    }
+
+    // Anything else can only be retried if repeating the request is safe
+    if method != http.MethodGet && method != http.MethodDelete {
+        return 0, false
+    }
+
+    if err != nil || response.StatusCode >= http.StatusInternalServerError {
+        return backoff, true
+    }
+
+    return 0, false
+}
+
+// send performs a single attempt of a request and reads the response body
+func (c *Client) send(ctx context.Context, method string, path string, body []byte) ([]byte, *http.Response, error) {
+    var reader io.Reader
+    if body != nil {
+        reader = bytes.NewReader(body)
+    }
+
+    request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+    if err != nil {
+        return nil, nil, fmt.Errorf("unable to create request: %v", err)
+    }
+
+    request.Header.Set("Accept", "application/json")
+    request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+    if body != nil {
+        request.Header.Set("Content-Type", "application/json")
+    }
+
+    response, err := c.client.Do(request)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer closeBody(response.Body)
+
+    contents, err := io.ReadAll(response.Body)
+    if err != nil {
+        return nil, response, fmt.Errorf("unable to read response: %v", err)
+    }
+
+    c.trackRateLimit(response.Header)
+
+    return contents, response, nil
+}
+
+// trackRateLimit pauses further requests until the rate limit resets once it has been used up
+func (c *Client) trackRateLimit(header http.Header) {
+    if header.Get("X-RateLimit-Remaining") != "0" {
+        return
+    }
+
+    wait, found := rateLimitDelay(header)
+    if !found {
+        return
+    }
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    c.resume = time.Now().Add(min(wait, maxBackoff))
+}
+
+// waitForRateLimit waits until the rate limit has reset if it was used up
+func (c *Client) waitForRateLimit(ctx context.Context) error {
+    c.mutex.Lock()
+    wait := time.Until(c.resume)
+    c.mutex.Unlock()
+
+    if wait <= 0 {
+        return nil
+    }
+
+    return sleep(ctx, wait)
+}
+
+// rateLimitDelay reads how long to wait from the Retry-After or X-RateLimit-Reset headers
+func rateLimitDelay(header http.Header) (time.Duration, bool) {
+    retryAfter := header.Get("Retry-After")
+    if seconds, err := strconv.Atoi(retryAfter); err == nil {
+        return time.Duration(seconds) * time.Second, true
+    }
+
+    if date, err := http.ParseTime(retryAfter); err == nil {
+        return max(time.Until(date), 0), true
+    }
+
+    if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+        return max(time.Until(time.Unix(reset, 0)), 0), true
+    }
+
+    return 0, false
+}
+
+// sleep waits for a duration unless the context is cancelled first
+func sleep(ctx context.Context, duration time.Duration) error {
+    timer := time.NewTimer(duration)
+    defer timer.Stop()
+
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
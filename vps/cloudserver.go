@@ -0,0 +1,134 @@
+package vps
+
+import (
+    "strings"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+type CloudServer struct {
+    client *Client
+    env    env.Env
+}
+
+type IP struct {
+    IP      string `json:"ip"`
+    Primary bool   `json:"is_primary"`
+}
+
+type Server struct {
+    Data     ServerData `json:"data,omitempty"`
+    FQDNs    []string   `json:"fqdns"`
+    IPTypes  []string   `json:"ip_types"`
+    Location int        `json:"location"`
+    Name     string     `json:"name"`
+    OS       int        `json:"os"`
+    Plan     int        `json:"plan"`
+    Project  int        `json:"project"`
+    Tags     []string   `json:"tags"`
+    UserData string     `json:"user_data"`
+}
+
+type ServerData struct {
+    Created string   `json:"created_at"`
+    ID      int      `json:"id"`
+    IPs     []IP     `json:"ips"`
+    Name    string   `json:"name"`
+    Status  string   `json:"status"`
+    Tags    []string `json:"tags"`
+}
+
+const apiURL = "https://cloudserver.nz/api/v1"
+const cloudServerProvider = "cloudserver"
+const defaultLocation = 1
+const defaultOS = 15
+const defaultPlan = 29
+const managedTag = "cloudserver-vpn"
+const statusRunning = "running"
+
+// NewCloudServer creates a provider for Voyager VPS Manager at cloudserver.nz
+func NewCloudServer(env env.Env) *CloudServer {
+    baseURL := env.CloudServer.URL
+    if baseURL == "" {
+        baseURL = apiURL
+    }
+
+    return &CloudServer{
+        client: NewClient(baseURL, env.CloudServer.ApiKey),
+        env:    env,
+    }
+}
+
+// location returns the configured location id or the default
+func (c *CloudServer) location() int {
+    if c.env.CloudServer.Location != 0 {
+        return c.env.CloudServer.Location
+    }
+
+    return defaultLocation
+}
+
+// os returns the configured operating system id or the default
+func (c *CloudServer) os() int {
+    if c.env.CloudServer.OS != 0 {
+        return c.env.CloudServer.OS
+    }
+
+    return defaultOS
+}
+
+// plan returns the configured plan id or the default
+func (c *CloudServer) plan() int {
+    if c.env.CloudServer.Plan != 0 {
+        return c.env.CloudServer.Plan
+    }
+
+    return defaultPlan
+}
+
+// created parses the time the server was created, returning the zero time if it isn't known
+func (s ServerData) created() time.Time {
+    for _, layout := range []string{time.RFC3339, time.DateTime} {
+        created, err := time.Parse(layout, s.Created)
+        if err == nil {
+            return created
+        }
+    }
+
+    return time.Time{}
+}
+
+// managed determines whether a server was created by this tool
+func (s ServerData) managed() bool {
+    for _, tag := range s.Tags {
+        if tag == managedTag {
+            return true
+        }
+    }
+
+    return false
+}
+
+// primaryIP returns the primary IP address for a server
+func (s ServerData) primaryIP() string {
+    for _, ip := range s.IPs {
+        if ip.Primary {
+            return ip.IP
+        }
+    }
+
+    return ""
+}
+
+// vps converts server data into a VPS
+func (s ServerData) vps() VPS {
+    return VPS{
+        Created: s.created(),
+        ID:      s.ID,
+        IP:      s.primaryIP(),
+        Managed: s.managed(),
+        Name:    s.Name,
+        Running: strings.EqualFold(s.Status, statusRunning),
+    }
+}
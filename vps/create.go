@@ -1,46 +1,36 @@
 package vps
 
 import (
-    "bytes"
-    "encoding/json"
+    "context"
     "errors"
     "fmt"
-    "io"
     "net/http"
     "strings"
 
     "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/wireguard"
 )
 
-type IP struct {
-    IP      string `json:"ip"`
-    Primary bool   `json:"is_primary"`
-}
-
-type Server struct {
-    Data     ServerData `json:"data,omitempty"`
-    FQDNs    []string   `json:"fqdns"`
-    IPTypes  []string   `json:"ip_types"`
-    Location int        `json:"location"`
-    Name     string     `json:"name"`
-    OS       int        `json:"os"`
-    Plan     int        `json:"plan"`
-    Project  int        `json:"project"`
-    UserData string     `json:"user_data"`
-}
-
-type ServerData struct {
-    ID   int    `json:"id"`
-    IPs  []IP   `json:"ips"`
-    Name string `json:"name"`
-}
-
-type VPS struct {
-    ID   int
-    IP   string
-    Name string
-}
-
+// Handshakes are saved by cron and served over http so idle servers can be detected
+const handshakeCommands = `
+  - apk add busybox-extras
+  - mkdir -p /var/www
+  - rc-update add crond default
+  - rc-service crond start
+  - rc-update add handshakes default
+  - rc-service handshakes start`
+const handshakeFilesTemplate = `
+- content: %s
+  encoding: b64
+  owner: root:root
+  path: /etc/init.d/handshakes
+  permissions: '0755'
+- append: true
+  content: %s
+  encoding: b64
+  owner: root:root
+  path: /etc/crontabs/root
+  permissions: '0600'`
 const userdataTemplate = `#cloud-config
 write_files:
 - content: bmV0LmlwdjQuY29uZi5hbGwucHJveHlfYXJwPTEKbmV0LmlwdjQuaXBfZm9yd2FyZD0xCg==
@@ -57,81 +47,129 @@ write_files:
   encoding: b64
   owner: root:root
   path: /etc/init.d/wireguard
-  permissions: '0755'
+  permissions: '0755'%s
 runcmd:
   - sysctl -p /etc/sysctl.d/wireguard.conf
   - apk add wireguard-tools
   - rc-update add wireguard default
-  - rc-service wireguard start`
+  - rc-service wireguard start%s`
+
+// Create a new virtual private server, reporting progress of each step
+func Create(ctx context.Context, env env.Env, progress Progress) (*VPS, error) {
+    return create(ctx, env, progress, false)
+}
+
+// Replace creates a new virtual private server even if one with the same name already exists, so the existing server
+// can keep running until its replacement is ready
+func Replace(ctx context.Context, env env.Env, progress Progress) (*VPS, error) {
+    return create(ctx, env, progress, true)
+}
 
-// Create a new virtual private server
-func Create(env env.Env) (*VPS, error) {
+// create a new virtual private server, returning an existing server with the same name instead unless it is being
+// replaced
+func create(ctx context.Context, env env.Env, progress Progress, replace bool) (*VPS, error) {
     errs := env.ValidateCreateEnv()
     if len(errs) > 0 {
         return nil, fmt.Errorf("unable to create new server:\n - %s", strings.Join(errs, "\n - "))
     }
 
-    projectID, err := findOrCreateProject(env)
+    provider, err := NewProvider(env)
     if err != nil {
         return nil, err
     }
 
-    payload, err := json.Marshal(&Server{
-        FQDNs:    []string{env.Server.FQDN},
-        IPTypes:  []string{"IPv4"},
-        Location: 1,
-        Name:     env.Server.FQDN,
-        OS:       15,
-        Plan:     29,
-        Project:  projectID,
-        UserData: fmt.Sprintf(userdataTemplate, generateEncodedWireguardConfiguration(env)),
-    })
+    progress.Report(StepExisting)
+    server, err := findExisting(ctx, env, provider)
     if err != nil {
-        return nil, fmt.Errorf("unable to marshal new server configuration: %v", err)
+        return nil, err
     }
 
-    request, err := http.NewRequest("POST", fmt.Sprintf("%s/servers", apiURL), bytes.NewBuffer(payload))
-    if err != nil {
-        return nil, fmt.Errorf("unable to create new server request: %v", err)
+    if server == nil || replace {
+        server, err = provider.Create(ctx, progress)
+        if err != nil {
+            return nil, err
+        }
     }
 
-    request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", env.CloudServer.ApiKey))
-    request.Header.Set("Content-Type", "application/json")
+    if env.Server.WaitTimeout > 0 {
+        progress.Report(StepReadiness)
+        err = waitForReady(ctx, env, provider, server)
+        if err != nil {
+            return nil, fmt.Errorf("server %d was created but is not ready, remove it with --remove %d: %v", server.ID, server.ID, err)
+        }
+    }
+
+    return server, nil
+}
+
+// userData generates the cloud-init configuration which installs WireGuard, and reports handshakes if idle servers
+// are removed
+func (c *CloudServer) userData() string {
+    files, commands := "", ""
+    if c.env.Server.IdleTimeout > 0 {
+        files = fmt.Sprintf(handshakeFilesTemplate, wireguard.EncodedHandshakeService(), wireguard.EncodedHandshakeCron(c.env))
+        commands = handshakeCommands
+    }
+
+    return fmt.Sprintf(userdataTemplate, wireguard.EncodedServerConfig(c.env), files, commands)
+}
 
-    client := &http.Client{}
-    response, err := client.Do(request)
+// findExisting returns the server created by this tool which already has the same name, or nil if there isn't one
+func findExisting(ctx context.Context, env env.Env, provider Provider) (*VPS, error) {
+    servers, err := provider.List(ctx)
     if err != nil {
-        return nil, fmt.Errorf("unable to create new server: %v", err)
+        return nil, err
     }
-    defer closeBody(response.Body)
 
-    body, _ := io.ReadAll(response.Body)
+    for _, server := range servers {
+        if !strings.EqualFold(server.Name, env.Server.FQDN) {
+            continue
+        }
+
+        if !server.Managed {
+            return nil, fmt.Errorf("server %d is already named %s but was not created by this tool, rename or remove it first", server.ID, server.Name)
+        }
+
+        server.Existing = true
 
-    if response.StatusCode != http.StatusCreated {
-        return nil, fmt.Errorf("unable to create new server, invalid status: %s - %s", response.Status, string(body))
+        return &server, nil
     }
 
-    var result Server
-    err = json.Unmarshal(body, &result)
+    return nil, nil
+}
+
+// Create a new server within the project
+func (c *CloudServer) Create(ctx context.Context, progress Progress) (*VPS, error) {
+    progress.Report(StepProject)
+    projectID, err := c.findOrCreateProject(ctx)
     if err != nil {
-        return nil, fmt.Errorf("error reading response from server: %v", err)
+        return nil, err
     }
 
-    var primaryIP string
-    for _, ip := range result.Data.IPs {
-        if ip.Primary {
-            primaryIP = ip.IP
-            break
-        }
+    progress.Report(StepServer)
+
+    payload := &Server{
+        FQDNs:    []string{c.env.Server.FQDN},
+        IPTypes:  []string{"IPv4"},
+        Location: c.location(),
+        Name:     c.env.Server.FQDN,
+        OS:       c.os(),
+        Plan:     c.plan(),
+        Project:  projectID,
+        Tags:     []string{managedTag},
+        UserData: c.userData(),
+    }
+
+    var result Server
+    err = c.client.Do(ctx, http.MethodPost, "/servers", payload, http.StatusCreated, &result)
+    if err != nil {
+        return nil, fmt.Errorf("unable to create new server: %w", err)
     }
 
-    if result.Data.ID == 0 || primaryIP == "" {
+    server := result.Data.vps()
+    if server.ID == 0 || server.IP == "" {
         return nil, errors.New("unable to detect whether server was successfully created: perform a manual check")
     }
 
-    return &VPS{
-        ID:   result.Data.ID,
-        IP:   primaryIP,
-        Name: result.Data.Name,
-    }, nil
+    return &server, nil
 }
@@ -0,0 +1,208 @@
+package vps
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/vps/vpstest"
+)
+
+func TestCreate(t *testing.T) {
+    fake := vpstest.New(t)
+    e := testEnv(t, fake)
+
+    var steps []string
+    server, err := Create(context.Background(), e, func(step string) { steps = append(steps, step) })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if server.ID == 0 || server.IP == "" || server.Name != "vpn" || !server.Managed || !server.Running || server.Existing {
+        t.Errorf("unexpected server: %+v", server)
+    }
+
+    if server.Created.IsZero() {
+        t.Error("expected creation time to be parsed")
+    }
+
+    expected := []string{StepExisting, StepProject, StepServer}
+    if strings.Join(steps, ",") != strings.Join(expected, ",") {
+        t.Errorf("expected steps %v, got %v", expected, steps)
+    }
+
+    projects := fake.Projects()
+    if len(projects) != 1 || projects[0].Name != projectName {
+        t.Errorf("expected project %s to be created, got %+v", projectName, projects)
+    }
+
+    servers := fake.Servers()
+    if len(servers) != 1 {
+        t.Fatalf("expected 1 server, got %d", len(servers))
+    }
+
+    if servers[0].Project != projects[0].ID || !hasTag(servers[0], managedTag) {
+        t.Errorf("unexpected server created: %+v", servers[0])
+    }
+
+    if servers[0].Location != defaultLocation || servers[0].OS != defaultOS || servers[0].Plan != defaultPlan {
+        t.Errorf("expected default location, os and plan, got %+v", servers[0])
+    }
+
+    if !strings.HasPrefix(servers[0].UserData, "#cloud-config") {
+        t.Error("expected cloud-init user data")
+    }
+}
+
+func TestCreateHandshakes(t *testing.T) {
+    tests := []struct {
+        idleTimeout time.Duration
+        name        string
+        reported    bool
+    }{
+        {name: "disabled"},
+        {idleTimeout: time.Hour, name: "enabled", reported: true},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+            e := testEnv(t, fake)
+            e.Server.IdleTimeout = test.idleTimeout
+
+            _, err := Create(context.Background(), e, func(string) {})
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            userData := fake.Servers()[0].UserData
+            if strings.Contains(userData, "/etc/init.d/handshakes") != test.reported {
+                t.Errorf("expected handshakes reported to be %t, got user data:\n%s", test.reported, userData)
+            }
+        })
+    }
+}
+
+func TestCreateExisting(t *testing.T) {
+    tests := []struct {
+        err      string
+        existing bool
+        name     string
+        tags     []string
+    }{
+        {existing: true, name: "managed", tags: []string{managedTag}},
+        {err: "was not created by this tool", name: "unmanaged"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+            projectID := fake.AddProject(projectName)
+            serverID := fake.AddServer(projectID, "VPN", test.tags...)
+
+            server, err := Create(context.Background(), testEnv(t, fake), nil)
+            if test.err != "" {
+                if err == nil || !strings.Contains(err.Error(), test.err) {
+                    t.Fatalf("expected error containing %q, got %v", test.err, err)
+                }
+            } else if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if test.existing && (server.ID != serverID || !server.Existing) {
+                t.Errorf("expected existing server %d, got %+v", serverID, server)
+            }
+
+            if countRequests(fake, "POST /servers") != 0 {
+                t.Error("expected no server to be created")
+            }
+        })
+    }
+}
+
+func TestReplace(t *testing.T) {
+    tests := []struct {
+        err  string
+        name string
+        tags []string
+    }{
+        {name: "managed", tags: []string{managedTag}},
+        {err: "was not created by this tool", name: "unmanaged"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+            projectID := fake.AddProject(projectName)
+            serverID := fake.AddServer(projectID, "VPN", test.tags...)
+
+            server, err := Replace(context.Background(), testEnv(t, fake), nil)
+            if test.err != "" {
+                if err == nil || !strings.Contains(err.Error(), test.err) {
+                    t.Fatalf("expected error containing %q, got %v", test.err, err)
+                }
+
+                return
+            }
+
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if server.ID == serverID || server.Existing {
+                t.Errorf("expected a new server to replace server %d, got %+v", serverID, server)
+            }
+
+            if count := len(fake.Servers()); count != 2 {
+                t.Errorf("expected the existing server to keep running beside its replacement, got %d servers", count)
+            }
+        })
+    }
+}
+
+func TestCreateFailure(t *testing.T) {
+    tests := []struct {
+        err     string
+        failure vpstest.Failure
+        name    string
+    }{
+        {err: "server error", failure: vpstest.Failure{Body: `{"message":"server error"}`, Status: http.StatusInternalServerError}, name: "server error"},
+        {err: "plan is invalid", failure: vpstest.Failure{Body: `{"message":"The selected plan is invalid."}`, Status: http.StatusUnprocessableEntity}, name: "validation"},
+        {err: "unable to detect", failure: vpstest.Failure{Body: `{"data":{}}`, Status: http.StatusCreated}, name: "missing data"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+            fake.AddProject(projectName)
+            fake.Fail("POST /servers", test.failure)
+
+            _, err := Create(context.Background(), testEnv(t, fake), nil)
+            if err == nil || !strings.Contains(err.Error(), test.err) {
+                t.Fatalf("expected error containing %q, got %v", test.err, err)
+            }
+
+            // Creating a server isn't idempotent so it must never be retried
+            if count := countRequests(fake, "POST /servers"); count != 1 {
+                t.Errorf("expected 1 create request, got %d", count)
+            }
+        })
+    }
+}
+
+func TestCreateInvalidEnv(t *testing.T) {
+    fake := vpstest.New(t)
+    e := testEnv(t, fake)
+    e.CloudServer.ApiKey = ""
+
+    _, err := Create(context.Background(), e, nil)
+    if err == nil || !strings.Contains(err.Error(), "CLOUDSERVER_APIKEY is mandatory") {
+        t.Fatalf("expected validation error, got %v", err)
+    }
+
+    if len(fake.Requests()) != 0 {
+        t.Errorf("expected no requests, got %v", fake.Requests())
+    }
+}
@@ -1,8 +1,8 @@
 package vps
 
 import (
+    "context"
     "fmt"
-    "io"
     "net/http"
     "strings"
 
@@ -10,42 +10,26 @@ import (
 )
 
 // Destroy an existing virtual private server
-func Destroy(env env.Env, serverID int) error {
+func Destroy(ctx context.Context, env env.Env, serverID int) error {
     errs := env.ValidateDestroyEnv()
     if len(errs) > 0 {
         return fmt.Errorf("unable to remove server:\n - %s", strings.Join(errs, "\n - "))
     }
 
-    request, err := http.NewRequest("DELETE", fmt.Sprintf("%s/servers/%d", apiURL, serverID), nil)
-    request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", env.CloudServer.ApiKey))
-
-    client := &http.Client{}
-    response, err := client.Do(request)
+    provider, err := NewProvider(env)
     if err != nil {
-        return fmt.Errorf("unable to remove server: %v", err)
+        return err
     }
-    defer closeBody(response.Body)
-
-    body, _ := io.ReadAll(response.Body)
 
-    if response.StatusCode != http.StatusOK {
-        return fmt.Errorf("unable to remove server, invalid status: %s - %s", response.Status, string(body))
-    }
-
-    return nil
+    return provider.Destroy(ctx, serverID)
 }
 
-// ListActiveVPS returns the IDs of all the active VPS servers
-func ListActiveVPS(env env.Env) ([]ServerData, error) {
-    errs := env.ValidateDestroyEnv()
-    if len(errs) > 0 {
-        return nil, fmt.Errorf("unable to remove servers:\n - %s", strings.Join(errs, "\n - "))
-    }
-
-    projectID, err := findOrCreateProject(env)
+// Destroy an existing server
+func (c *CloudServer) Destroy(ctx context.Context, serverID int) error {
+    err := c.client.Do(ctx, http.MethodDelete, fmt.Sprintf("/servers/%d", serverID), nil, http.StatusOK, nil)
     if err != nil {
-        return nil, err
+        return fmt.Errorf("unable to remove server: %w", err)
     }
 
-    return listProjectVPS(env, projectID)
+    return nil
 }
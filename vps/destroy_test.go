@@ -0,0 +1,110 @@
+package vps
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+
+    "github.com/sjdaws/cloudserver-vpn/vps/vpstest"
+)
+
+func TestDestroy(t *testing.T) {
+    fake := vpstest.New(t)
+    projectID := fake.AddProject(projectName)
+    serverID := fake.AddServer(projectID, "vpn", managedTag)
+    otherID := fake.AddServer(projectID, "other", managedTag)
+
+    err := Destroy(context.Background(), testEnv(t, fake), serverID)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    servers := fake.Servers()
+    if len(servers) != 1 || servers[0].ID != otherID {
+        t.Errorf("expected only server %d to remain, got %+v", otherID, servers)
+    }
+}
+
+func TestDestroyNotFound(t *testing.T) {
+    fake := vpstest.New(t)
+    fake.AddProject(projectName)
+
+    err := Destroy(context.Background(), testEnv(t, fake), 999)
+
+    var apiErr *APIError
+    if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+        t.Fatalf("expected not found error, got %v", err)
+    }
+
+    if count := countRequests(fake, "DELETE /servers/999"); count != 1 {
+        t.Errorf("expected 1 request, got %d", count)
+    }
+}
+
+func TestDestroyRetry(t *testing.T) {
+    tests := []struct {
+        failure vpstest.Failure
+        name    string
+    }{
+        {failure: vpstest.Failure{Headers: map[string]string{"Retry-After": "0"}, Status: http.StatusTooManyRequests}, name: "rate limited"},
+        {failure: vpstest.Failure{Body: `{"message":"Service Unavailable"}`, Status: http.StatusServiceUnavailable}, name: "server error"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+            serverID := fake.AddServer(fake.AddProject(projectName), "vpn", managedTag)
+            route := fmt.Sprintf("DELETE /servers/%d", serverID)
+            fake.Fail(route, test.failure)
+
+            err := Destroy(context.Background(), testEnv(t, fake), serverID)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if count := countRequests(fake, route); count != 2 {
+                t.Errorf("expected 2 requests, got %d", count)
+            }
+
+            if len(fake.Servers()) != 0 {
+                t.Error("expected server to be removed after retrying")
+            }
+        })
+    }
+}
+
+func TestDestroyRetryNotFound(t *testing.T) {
+    tests := []struct {
+        failure vpstest.Failure
+        name    string
+        removed bool
+    }{
+        {failure: vpstest.Failure{Headers: map[string]string{"Retry-After": "0"}, Status: http.StatusTooManyRequests}, name: "rate limited"},
+        {failure: vpstest.Failure{Status: http.StatusBadGateway}, name: "server error", removed: true},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+            fake.AddProject(projectName)
+            fake.Fail("DELETE /servers/999", test.failure)
+
+            // The server doesn't exist, as if the first attempt removed it before failing
+            err := Destroy(context.Background(), testEnv(t, fake), 999)
+            if test.removed && err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            var apiErr *APIError
+            if !test.removed && (!errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound) {
+                t.Fatalf("expected not found error, got %v", err)
+            }
+
+            if count := countRequests(fake, "DELETE /servers/999"); count != 2 {
+                t.Errorf("expected 2 requests, got %d", count)
+            }
+        })
+    }
+}
@@ -0,0 +1,97 @@
+package vps
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+// Get a single virtual private server
+func Get(ctx context.Context, env env.Env, serverID int) (*VPS, error) {
+    errs := env.ValidateDestroyEnv()
+    if len(errs) > 0 {
+        return nil, fmt.Errorf("unable to find server:\n - %s", strings.Join(errs, "\n - "))
+    }
+
+    provider, err := NewProvider(env)
+    if err != nil {
+        return nil, err
+    }
+
+    return provider.Get(ctx, serverID)
+}
+
+// ListActiveVPS returns all the active VPS servers
+func ListActiveVPS(ctx context.Context, env env.Env) ([]VPS, error) {
+    errs := env.ValidateDestroyEnv()
+    if len(errs) > 0 {
+        return nil, fmt.Errorf("unable to list servers:\n - %s", strings.Join(errs, "\n - "))
+    }
+
+    provider, err := NewProvider(env)
+    if err != nil {
+        return nil, err
+    }
+
+    return provider.List(ctx)
+}
+
+// ListManagedVPS returns the active VPS servers which were created by this tool
+func ListManagedVPS(ctx context.Context, env env.Env) ([]VPS, error) {
+    servers, err := ListActiveVPS(ctx, env)
+    if err != nil {
+        return nil, err
+    }
+
+    managed := make([]VPS, 0, len(servers))
+    for _, server := range servers {
+        if server.Managed {
+            managed = append(managed, server)
+        }
+    }
+
+    return managed, nil
+}
+
+// Get an existing server by id
+func (c *CloudServer) Get(ctx context.Context, serverID int) (*VPS, error) {
+    var result Server
+    err := c.client.Do(ctx, http.MethodGet, fmt.Sprintf("/servers/%d", serverID), nil, http.StatusOK, &result)
+
+    var apiErr *APIError
+    if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+        return nil, fmt.Errorf("unable to get server %d: %w", serverID, ErrNotFound)
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("unable to get server %d: %w", serverID, err)
+    }
+
+    server := result.Data.vps()
+
+    return &server, nil
+}
+
+// List all servers in the project
+func (c *CloudServer) List(ctx context.Context) ([]VPS, error) {
+    projectID, err := c.findOrCreateProject(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    servers, err := c.listProjectVPS(ctx, projectID)
+    if err != nil {
+        return nil, err
+    }
+
+    active := make([]VPS, 0, len(servers))
+    for _, server := range servers {
+        active = append(active, server.vps())
+    }
+
+    return active, nil
+}
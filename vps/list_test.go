@@ -0,0 +1,125 @@
+package vps
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/vps/vpstest"
+)
+
+func TestListActiveVPS(t *testing.T) {
+    fake := vpstest.New(t)
+    fake.PageSize = 2
+
+    projectID := fake.AddProject(projectName)
+    otherID := fake.AddProject("Other")
+    fake.AddServer(otherID, "elsewhere", managedTag)
+
+    for i := 0; i < 5; i++ {
+        fake.AddServer(projectID, fmt.Sprintf("vpn%d", i), managedTag)
+    }
+    fake.AddServer(projectID, "unmanaged")
+
+    e := testEnv(t, fake)
+
+    servers, err := ListActiveVPS(context.Background(), e)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if len(servers) != 6 {
+        t.Fatalf("expected 6 servers across every page, got %d", len(servers))
+    }
+
+    for i, server := range servers[:5] {
+        if server.Name != fmt.Sprintf("vpn%d", i) || !server.Managed || server.IP == "" {
+            t.Errorf("unexpected server: %+v", server)
+        }
+    }
+
+    if servers[5].Managed {
+        t.Error("expected server without tag to be unmanaged")
+    }
+
+    if count := countRequests(fake, fmt.Sprintf("GET /projects/%d/servers", projectID)); count != 3 {
+        t.Errorf("expected 3 pages to be requested, got %d", count)
+    }
+
+    managed, err := ListManagedVPS(context.Background(), e)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if len(managed) != 5 {
+        t.Errorf("expected 5 managed servers, got %d", len(managed))
+    }
+}
+
+func TestListActiveVPSEmpty(t *testing.T) {
+    fake := vpstest.New(t)
+    fake.AddProject(projectName)
+
+    servers, err := ListActiveVPS(context.Background(), testEnv(t, fake))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if len(servers) != 0 {
+        t.Errorf("expected no servers, got %+v", servers)
+    }
+}
+
+func TestListActiveVPSUnauthorised(t *testing.T) {
+    fake := vpstest.New(t)
+    e := testEnv(t, fake)
+    e.CloudServer.ApiKey = "incorrect"
+
+    _, err := ListActiveVPS(context.Background(), e)
+
+    var apiErr *APIError
+    if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Unauthenticated." {
+        t.Fatalf("expected unauthorised error, got %v", err)
+    }
+}
+
+func TestListActiveVPSTimeout(t *testing.T) {
+    fake := vpstest.New(t)
+    fake.AddProject(projectName)
+    fake.Latency = 200 * time.Millisecond
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+
+    _, err := ListActiveVPS(ctx, testEnv(t, fake))
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expected deadline exceeded, got %v", err)
+    }
+
+    if len(fake.Requests()) != 1 {
+        t.Errorf("expected request not to be retried after the deadline, got %v", fake.Requests())
+    }
+}
+
+func TestGet(t *testing.T) {
+    fake := vpstest.New(t)
+    serverID := fake.AddServer(fake.AddProject(projectName), "vpn", managedTag)
+    e := testEnv(t, fake)
+
+    server, err := Get(context.Background(), e, serverID)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if server.ID != serverID || server.Name != "vpn" {
+        t.Errorf("unexpected server: %+v", server)
+    }
+
+    _, err = Get(context.Background(), e, serverID+1)
+    if !errors.Is(err, ErrNotFound) {
+        t.Errorf("expected not found, got %v", err)
+    }
+}
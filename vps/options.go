@@ -0,0 +1,67 @@
+package vps
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+type OptionData struct {
+    ID   int    `json:"id"`
+    Name string `json:"name"`
+}
+
+// ListOptions returns the locations, operating systems and plans available from the provider
+func ListOptions(ctx context.Context, env env.Env) (*Options, error) {
+    errs := env.ValidateDestroyEnv()
+    if len(errs) > 0 {
+        return nil, fmt.Errorf("unable to list options:\n - %s", strings.Join(errs, "\n - "))
+    }
+
+    provider, err := NewProvider(env)
+    if err != nil {
+        return nil, err
+    }
+
+    return provider.Options(ctx)
+}
+
+// Options lists the locations, operating systems and plans available at cloudserver.nz
+func (c *CloudServer) Options(ctx context.Context) (*Options, error) {
+    var options Options
+    var err error
+
+    options.Locations, err = c.listOptions(ctx, "locations")
+    if err != nil {
+        return nil, err
+    }
+
+    options.OperatingSystems, err = c.listOptions(ctx, "operating-systems")
+    if err != nil {
+        return nil, err
+    }
+
+    options.Plans, err = c.listOptions(ctx, "plans")
+    if err != nil {
+        return nil, err
+    }
+
+    return &options, nil
+}
+
+// listOptions lists the ids and names for a resource
+func (c *CloudServer) listOptions(ctx context.Context, resource string) ([]Option, error) {
+    data, err := listAll[OptionData](ctx, c.client, "/"+resource)
+    if err != nil {
+        return nil, fmt.Errorf("unable to list %s: %w", resource, err)
+    }
+
+    options := make([]Option, 0, len(data))
+    for _, option := range data {
+        options = append(options, Option{ID: option.ID, Name: option.Name})
+    }
+
+    return options, nil
+}
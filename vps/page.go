@@ -0,0 +1,108 @@
+package vps
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+// Page is a single page of a list response
+type Page[T any] struct {
+    Data  []T       `json:"data"`
+    Links PageLinks `json:"links"`
+    Meta  PageMeta  `json:"meta"`
+}
+
+type PageLinks struct {
+    Next string `json:"next"`
+}
+
+type PageMeta struct {
+    CurrentPage int `json:"current_page"`
+    LastPage    int `json:"last_page"`
+}
+
+const maxPages = 100
+
+// listAll requests every page of a list endpoint and returns the combined results, following links.next when the
+// response includes it
+func listAll[T any](ctx context.Context, client *Client, path string) ([]T, error) {
+    all := make([]T, 0)
+    pagePath := path
+    previous := 0
+
+    for number := 1; ; number++ {
+        var page Page[T]
+        err := client.Do(ctx, http.MethodGet, pagePath, nil, http.StatusOK, &page)
+        if err != nil {
+            return nil, err
+        }
+
+        // An API which ignores the page requested returns the same page again, which would duplicate the results
+        if len(page.Data) == 0 || (page.Meta.CurrentPage != 0 && page.Meta.CurrentPage <= previous) {
+            return all, nil
+        }
+
+        all = append(all, page.Data...)
+        previous = page.Meta.CurrentPage
+
+        if !page.hasNext(number) {
+            return all, nil
+        }
+
+        if number >= maxPages {
+            return nil, fmt.Errorf("more than %d pages were returned for %s", maxPages, path)
+        }
+
+        pagePath, err = page.nextPath(client.baseURL, path, number+1)
+        if err != nil {
+            return nil, err
+        }
+    }
+}
+
+// hasNext determines whether there is another page after this one from the links or metadata in the response
+func (p Page[T]) hasNext(number int) bool {
+    if p.Links.Next != "" {
+        return true
+    }
+
+    current := p.Meta.CurrentPage
+    if current == 0 {
+        current = number
+    }
+
+    return current < p.Meta.LastPage
+}
+
+// nextPath returns the path of the next page from links.next, or adds the page number to the original path if there
+// isn't a link to the same API, so the api key is never sent anywhere else
+func (p Page[T]) nextPath(baseURL string, path string, number int) (string, error) {
+    next, found := strings.CutPrefix(p.Links.Next, baseURL)
+    if found && strings.HasPrefix(next, "/") {
+        return next, nil
+    }
+
+    return withPage(path, number)
+}
+
+// withPage adds a page number to the query string of a path, the first page is requested without one
+func withPage(path string, number int) (string, error) {
+    if number == 1 {
+        return path, nil
+    }
+
+    parsed, err := url.Parse(path)
+    if err != nil {
+        return "", fmt.Errorf("unable to add page to %s: %v", path, err)
+    }
+
+    query := parsed.Query()
+    query.Set("page", strconv.Itoa(number))
+    parsed.RawQuery = query.Encode()
+
+    return parsed.String(), nil
+}
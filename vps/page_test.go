@@ -0,0 +1,121 @@
+package vps
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestListAll(t *testing.T) {
+    tests := []struct {
+        expected []int
+        name     string
+        pages    func(server string, request *http.Request) Page[int]
+        requests []string
+    }{
+        {
+            expected: []int{1, 2, 3},
+            name:     "follows next link",
+            pages: func(server string, request *http.Request) Page[int] {
+                if request.URL.Query().Get("cursor") == "b" {
+                    return Page[int]{Data: []int{3}}
+                }
+
+                return Page[int]{Data: []int{1, 2}, Links: PageLinks{Next: server + "/items?cursor=b"}}
+            },
+            requests: []string{"/items", "/items?cursor=b"},
+        },
+        {
+            expected: []int{1, 2},
+            name:     "next link to another host",
+            pages: func(_ string, request *http.Request) Page[int] {
+                page, _ := strconv.Atoi(request.URL.Query().Get("page"))
+                page = max(page, 1)
+
+                if page > 1 {
+                    return Page[int]{Data: []int{page}, Meta: PageMeta{CurrentPage: page, LastPage: 2}}
+                }
+
+                return Page[int]{Data: []int{page}, Links: PageLinks{Next: "https://elsewhere.example/items?page=2"}, Meta: PageMeta{CurrentPage: page, LastPage: 2}}
+            },
+            requests: []string{"/items", "/items?page=2"},
+        },
+        {
+            expected: []int{1, 2},
+            name:     "page ignored",
+            pages: func(_ string, _ *http.Request) Page[int] {
+                return Page[int]{Data: []int{1, 2}, Meta: PageMeta{CurrentPage: 1, LastPage: 3}}
+            },
+            requests: []string{"/items", "/items?page=2"},
+        },
+        {
+            expected: []int{1},
+            name:     "empty page",
+            pages: func(server string, request *http.Request) Page[int] {
+                if request.URL.Query().Has("cursor") {
+                    return Page[int]{Links: PageLinks{Next: server + "/items?cursor=c"}}
+                }
+
+                return Page[int]{Data: []int{1}, Links: PageLinks{Next: server + "/items?cursor=b"}}
+            },
+            requests: []string{"/items", "/items?cursor=b"},
+        },
+        {
+            expected: []int{1, 2},
+            name:     "metadata only",
+            pages: func(_ string, request *http.Request) Page[int] {
+                page, _ := strconv.Atoi(request.URL.Query().Get("page"))
+                page = max(page, 1)
+
+                return Page[int]{Data: []int{page}, Meta: PageMeta{CurrentPage: page, LastPage: 2}}
+            },
+            requests: []string{"/items", "/items?page=2"},
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            var requests []string
+            var server *httptest.Server
+            server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+                requests = append(requests, request.URL.RequestURI())
+                _ = json.NewEncoder(response).Encode(test.pages(server.URL, request))
+            }))
+            defer server.Close()
+
+            items, err := listAll[int](context.Background(), NewClient(server.URL, "key"), "/items")
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if !slices.Equal(items, test.expected) {
+                t.Errorf("expected items %v, got %v", test.expected, items)
+            }
+
+            if !slices.Equal(requests, test.requests) {
+                t.Errorf("expected requests %v, got %v", test.requests, requests)
+            }
+        })
+    }
+}
+
+func TestListAllTooManyPages(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        page, _ := strconv.Atoi(request.URL.Query().Get("page"))
+        page = max(page, 1)
+
+        _ = json.NewEncoder(response).Encode(Page[int]{Data: []int{page}, Meta: PageMeta{CurrentPage: page, LastPage: maxPages + 1}})
+    }))
+    defer server.Close()
+
+    _, err := listAll[int](context.Background(), NewClient(server.URL, "key"), "/items")
+    if err == nil || !strings.Contains(err.Error(), "more than 100 pages") {
+        t.Fatalf("expected too many pages error, got %v", err)
+    }
+}
+
@@ -1,14 +1,11 @@
 package vps
 
 import (
-    "bytes"
-    "encoding/json"
+    "context"
     "fmt"
-    "io"
     "net/http"
+    "net/url"
     "strings"
-
-    "github.com/sjdaws/cloudserver-vpn/env"
 )
 
 type Project struct {
@@ -22,65 +19,33 @@ type ProjectData struct {
     Name string `json:"name"`
 }
 
-type ProjectSearch struct {
-    Data []ProjectData `json:"data"`
-}
-
-type ServerSearch struct {
-    Data []ServerData `json:"data"`
-}
-
 const projectName = "VPNs"
 
 // createProject creates a new project
-func createProject(env env.Env) (int, error) {
-    payload, err := json.Marshal(&Project{
+func (c *CloudServer) createProject(ctx context.Context) (int, error) {
+    payload := &Project{
         Description: "VPN servers created by cloudserver-vpn",
         Name:        projectName,
-    })
-    if err != nil {
-        return 0, fmt.Errorf("unable to marshal new project configuration: %v", err)
-    }
-
-    request, err := http.NewRequest("POST", fmt.Sprintf("%s/projects", apiURL), bytes.NewBuffer(payload))
-    if err != nil {
-        return 0, fmt.Errorf("unable to create new project request: %v", err)
-    }
-
-    request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", env.CloudServer.ApiKey))
-    request.Header.Set("Content-Type", "application/json")
-
-    client := &http.Client{}
-    response, err := client.Do(request)
-    if err != nil {
-        return 0, fmt.Errorf("unable to create new project: %v", err)
-    }
-    defer closeBody(response.Body)
-
-    body, _ := io.ReadAll(response.Body)
-
-    if response.StatusCode != http.StatusCreated {
-        return 0, fmt.Errorf("unable to create new project, invalid status: %s - %s", response.Status, string(body))
     }
 
     var result Project
-    err = json.Unmarshal(body, &result)
+    err := c.client.Do(ctx, http.MethodPost, "/projects", payload, http.StatusCreated, &result)
     if err != nil {
-        return 0, fmt.Errorf("error reading response from server: %v", err)
+        return 0, fmt.Errorf("unable to create new project: %w", err)
     }
 
     return result.Data.ID, nil
 }
 
 // findOrCreateProject attempts to find the project to use, creates it if it doesn't exist
-func findOrCreateProject(env env.Env) (int, error) {
+func (c *CloudServer) findOrCreateProject(ctx context.Context) (int, error) {
     // If project is set in env, use it
-    if env.CloudServer.Project != 0 {
-        return env.CloudServer.Project, nil
+    if c.env.CloudServer.Project != 0 {
+        return c.env.CloudServer.Project, nil
     }
 
     // Find project
-    projectID, err := findProject(env)
+    projectID, err := c.findProject(ctx)
     if err != nil {
         return 0, err
     }
@@ -90,38 +55,17 @@ func findOrCreateProject(env env.Env) (int, error) {
     }
 
     // Create project
-    return createProject(env)
+    return c.createProject(ctx)
 }
 
 // findProject attempts to find the project to use, creates it if it doesn't exist
-func findProject(env env.Env) (int, error) {
-    request, err := http.NewRequest("GET", fmt.Sprintf("%s/projects?filter[search]=%s", apiURL, projectName), nil)
-    if err != nil {
-        return 0, fmt.Errorf("unable to create project search request: %v", err)
-    }
-
-    request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", env.CloudServer.ApiKey))
-
-    client := &http.Client{}
-    response, err := client.Do(request)
+func (c *CloudServer) findProject(ctx context.Context) (int, error) {
+    projects, err := listAll[ProjectData](ctx, c.client, "/projects?filter[search]="+url.QueryEscape(projectName))
     if err != nil {
-        return 0, fmt.Errorf("unable to perform project search: %v", err)
-    }
-    defer closeBody(response.Body)
-
-    body, _ := io.ReadAll(response.Body)
-
-    if response.StatusCode != http.StatusOK {
-        return 0, fmt.Errorf("unable to perform project search, invalid status: %s - %s", response.Status, string(body))
+        return 0, fmt.Errorf("unable to perform project search: %w", err)
     }
 
-    var result ProjectSearch
-    err = json.Unmarshal(body, &result)
-    if err != nil {
-        return 0, fmt.Errorf("error reading response from server: %v", err)
-    }
-
-    for _, project := range result.Data {
+    for _, project := range projects {
         if strings.EqualFold(project.Name, projectName) {
             return project.ID, nil
         }
@@ -131,32 +75,11 @@ func findProject(env env.Env) (int, error) {
 }
 
 // listProjectVPS lists all the servers in a project
-func listProjectVPS(env env.Env, projectID int) ([]ServerData, error) {
-    request, err := http.NewRequest("GET", fmt.Sprintf("%s/projects/%d/servers", apiURL, projectID), nil)
-    if err != nil {
-        return nil, fmt.Errorf("unable to create server search request: %v", err)
-    }
-
-    request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", env.CloudServer.ApiKey))
-
-    client := &http.Client{}
-    response, err := client.Do(request)
-    if err != nil {
-        return nil, fmt.Errorf("unable to perform server search: %v", err)
-    }
-    defer closeBody(response.Body)
-
-    body, _ := io.ReadAll(response.Body)
-
-    if response.StatusCode != http.StatusOK {
-        return nil, fmt.Errorf("unable to perform server search, invalid status: %s - %s", response.Status, string(body))
-    }
-
-    var result ServerSearch
-    err = json.Unmarshal(body, &result)
+func (c *CloudServer) listProjectVPS(ctx context.Context, projectID int) ([]ServerData, error) {
+    servers, err := listAll[ServerData](ctx, c.client, fmt.Sprintf("/projects/%d/servers", projectID))
     if err != nil {
-        return nil, fmt.Errorf("error reading response from server: %v", err)
+        return nil, fmt.Errorf("unable to perform server search: %w", err)
     }
 
-    return result.Data, nil
+    return servers, nil
 }
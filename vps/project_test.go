@@ -0,0 +1,95 @@
+package vps
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/sjdaws/cloudserver-vpn/vps/vpstest"
+)
+
+func TestFindOrCreateProject(t *testing.T) {
+    tests := []struct {
+        configured bool
+        created    bool
+        existing   []string
+        name       string
+    }{
+        {created: true, name: "no projects"},
+        {existing: []string{"Other", projectName}, name: "existing project"},
+        {existing: []string{strings.ToLower(projectName)}, name: "case insensitive"},
+        {created: true, existing: []string{projectName + " archive"}, name: "partial match"},
+        {configured: true, existing: []string{projectName}, name: "configured project"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+
+            expected := 0
+            for _, name := range test.existing {
+                id := fake.AddProject(name)
+                if strings.EqualFold(name, projectName) {
+                    expected = id
+                }
+            }
+
+            e := testEnv(t, fake)
+            if test.configured {
+                e.CloudServer.Project = 42
+                expected = 42
+            }
+
+            projectID, err := NewCloudServer(e).findOrCreateProject(context.Background())
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if test.created {
+                projects := fake.Projects()
+                created := projects[len(projects)-1]
+                if created.Name != projectName || created.Description == "" {
+                    t.Errorf("unexpected project created: %+v", created)
+                }
+
+                expected = created.ID
+            }
+
+            if projectID != expected {
+                t.Errorf("expected project %d, got %d", expected, projectID)
+            }
+
+            if count := countRequests(fake, "POST /projects"); (count == 1) != test.created {
+                t.Errorf("expected project created %v, got %d create requests", test.created, count)
+            }
+
+            if test.configured && len(fake.Requests()) != 0 {
+                t.Errorf("expected no requests for a configured project, got %v", fake.Requests())
+            }
+        })
+    }
+}
+
+func TestFindOrCreateProjectFailure(t *testing.T) {
+    tests := []struct {
+        err   string
+        name  string
+        route string
+    }{
+        {err: "unable to perform project search", name: "search", route: "GET /projects"},
+        {err: "unable to create new project", name: "create", route: "POST /projects"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fake := vpstest.New(t)
+            fake.Fail(test.route, vpstest.Failure{Body: `{"message":"Forbidden"}`, Status: http.StatusForbidden})
+
+            _, err := NewCloudServer(testEnv(t, fake)).findOrCreateProject(context.Background())
+            if err == nil || !strings.Contains(err.Error(), test.err) || !strings.Contains(err.Error(), "Forbidden") {
+                t.Fatalf("expected error containing %q, got %v", test.err, err)
+            }
+        })
+    }
+}
@@ -0,0 +1,130 @@
+package vps
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "strconv"
+    "syscall"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/wireguard"
+)
+
+const closedPort = 9
+const icmpGrace = time.Minute
+const pollInterval = 5 * time.Second
+const probeTimeout = 2 * time.Second
+
+var errPortClosed = errors.New("port closed")
+
+// waitForReady polls the provider until the server is running then probes WireGuard until it is listening
+func waitForReady(ctx context.Context, env env.Env, provider Provider, server *VPS) error {
+    deadline := time.Now().Add(env.Server.WaitTimeout)
+
+    for {
+        current, err := provider.Get(ctx, server.ID)
+        if err == nil && current.Running {
+            break
+        }
+
+        if err != nil && (ctx.Err() != nil || !transient(err)) {
+            return fmt.Errorf("unable to check whether server is running: %w", err)
+        }
+
+        if time.Now().After(deadline) {
+            if err != nil {
+                return fmt.Errorf("server did not start running within %s: %v", env.Server.WaitTimeout, err)
+            }
+
+            return fmt.Errorf("server did not start running within %s", env.Server.WaitTimeout)
+        }
+
+        err = sleep(ctx, pollInterval)
+        if err != nil {
+            return err
+        }
+    }
+
+    port := wireguard.ListenPort(env)
+    if port == 0 {
+        // WireGuard picks a random port, so there is nothing to probe
+        return nil
+    }
+
+    // A host which isn't up is silent as well, so a closed port must be refused before silence counts. If ICMP is
+    // filtered the closed port is never refused, so after a grace period only the WireGuard port is probed
+    running := time.Now()
+    refused := false
+    for {
+        closed := probeUDP(server.IP, closedPort)
+        if closed == errPortClosed {
+            refused = true
+        }
+
+        filtered := !refused && time.Since(running) >= icmpGrace
+        if (closed == errPortClosed || filtered) && probeUDP(server.IP, port) == nil {
+            return nil
+        }
+
+        if time.Now().After(deadline) {
+            return fmt.Errorf("wireguard was not reachable on %s within %s", net.JoinHostPort(server.IP, strconv.Itoa(port)), env.Server.WaitTimeout)
+        }
+
+        err := sleep(ctx, pollInterval)
+        if err != nil {
+            return err
+        }
+    }
+}
+
+// transient determines whether an error from the provider may succeed if retried
+func transient(err error) bool {
+    if errors.Is(err, ErrNotFound) {
+        return false
+    }
+
+    var apiErr *APIError
+    if errors.As(err, &apiErr) {
+        return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+    }
+
+    return true
+}
+
+// probeUDP sends a single packet to a UDP port. WireGuard never replies to unauthenticated packets, so
+// silence means something is listening while an ICMP port unreachable reply means nothing is
+func probeUDP(ip string, port int) error {
+    conn, err := net.DialTimeout("udp", net.JoinHostPort(ip, strconv.Itoa(port)), probeTimeout)
+    if err != nil {
+        return err
+    }
+    defer func() {
+        _ = conn.Close()
+    }()
+
+    err = conn.SetDeadline(time.Now().Add(probeTimeout))
+    if err != nil {
+        return err
+    }
+
+    _, err = conn.Write([]byte{0})
+    if err == nil {
+        _, err = conn.Read(make([]byte, 1))
+    }
+
+    var netErr net.Error
+    switch {
+    case errors.Is(err, syscall.ECONNREFUSED):
+        return errPortClosed
+    case errors.As(err, &netErr) && netErr.Timeout():
+        return nil
+    case err == nil:
+        return nil
+    }
+
+    return err
+}
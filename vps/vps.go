@@ -1,10 +1,80 @@
 package vps
 
 import (
+    "context"
+    "errors"
+    "fmt"
     "io"
+    "strings"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
 )
 
-const apiURL = "https://cloudserver.nz/api/v1"
+// Provider is implemented by each host which can run a VPN server
+type Provider interface {
+    // Create a new server configured to run WireGuard
+    Create(ctx context.Context, progress Progress) (*VPS, error)
+    // Destroy an existing server
+    Destroy(ctx context.Context, serverID int) error
+    // Get an existing server
+    Get(ctx context.Context, serverID int) (*VPS, error)
+    // List all active servers
+    List(ctx context.Context) ([]VPS, error)
+    // Options lists the locations, operating systems and plans which can be used to create a server
+    Options(ctx context.Context) (*Options, error)
+}
+
+type Option struct {
+    ID   int
+    Name string
+}
+
+type Options struct {
+    Locations        []Option
+    OperatingSystems []Option
+    Plans            []Option
+}
+
+// Progress is called with the name of each step as it starts
+type Progress func(step string)
+
+type VPS struct {
+    Created  time.Time
+    Existing bool
+    ID       int
+    IP       string
+    Managed  bool
+    Name     string
+    Running  bool
+}
+
+const (
+    StepExisting  = "existing server lookup"
+    StepProject   = "project lookup"
+    StepReadiness = "readiness"
+    StepServer    = "server create"
+)
+
+// ErrNotFound is returned when a server doesn't exist
+var ErrNotFound = errors.New("server not found")
+
+// NewProvider returns the provider selected by VPS_PROVIDER
+func NewProvider(env env.Env) (Provider, error) {
+    switch strings.ToLower(env.VPS.Provider) {
+    case "", cloudServerProvider:
+        return NewCloudServer(env), nil
+    }
+
+    return nil, fmt.Errorf("unknown vps provider '%s'", env.VPS.Provider)
+}
+
+// Report the start of a step if progress is being tracked
+func (p Progress) Report(step string) {
+    if p != nil {
+        p(step)
+    }
+}
 
 // closeBody closes a ReadCloser ignoring errors
 func closeBody(body io.ReadCloser) {
@@ -0,0 +1,52 @@
+package vps
+
+import (
+    "testing"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/keys"
+    "github.com/sjdaws/cloudserver-vpn/vps/vpstest"
+)
+
+// testEnv returns a valid configuration which points at a fake API
+func testEnv(t *testing.T, fake *vpstest.Server) env.Env {
+    t.Helper()
+
+    privateKey, err := keys.Generate()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var e env.Env
+    e.CloudServer.ApiKey = vpstest.APIKey
+    e.CloudServer.URL = fake.URL
+    e.Server.FQDN = "vpn"
+    e.Server.Name = "vpn"
+    e.Wireguard.Interface.Address = "10.0.0.1/24"
+    e.Wireguard.Interface.PrivateKey = privateKey
+
+    return e
+}
+
+// countRequests returns the number of requests the fake received for a method and path
+func countRequests(fake *vpstest.Server, route string) int {
+    count := 0
+    for _, request := range fake.Requests() {
+        if request == route {
+            count++
+        }
+    }
+
+    return count
+}
+
+// hasTag determines whether a fake server has a tag
+func hasTag(server vpstest.VPS, tag string) bool {
+    for _, value := range server.Tags {
+        if value == tag {
+            return true
+        }
+    }
+
+    return false
+}
@@ -0,0 +1,392 @@
+// Package vpstest provides an in-process fake of the cloudserver.nz API for tests
+package vpstest
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Failure is returned instead of the normal response for matching requests
+type Failure struct {
+    Body    string
+    Headers map[string]string
+    Status  int
+    Times   int
+}
+
+type IP struct {
+    IP      string `json:"ip"`
+    Primary bool   `json:"is_primary"`
+}
+
+type Project struct {
+    Description string `json:"description,omitempty"`
+    ID          int    `json:"id"`
+    Name        string `json:"name"`
+}
+
+// Server is a fake API which records the projects and servers created through it
+type Server struct {
+    *httptest.Server
+
+    APIKey   string
+    Latency  time.Duration
+    PageSize int
+
+    failures map[string]*Failure
+    mutex    sync.Mutex
+    nextID   int
+    projects []Project
+    requests []string
+    servers  []VPS
+}
+
+type VPS struct {
+    Created  string   `json:"created_at"`
+    ID       int      `json:"id"`
+    IPs      []IP     `json:"ips"`
+    Location int      `json:"location"`
+    Name     string   `json:"name"`
+    OS       int      `json:"os"`
+    Plan     int      `json:"plan"`
+    Project  int      `json:"project"`
+    Status   string   `json:"status"`
+    Tags     []string `json:"tags"`
+    UserData string   `json:"-"`
+}
+
+type createServer struct {
+    FQDNs    []string `json:"fqdns"`
+    IPTypes  []string `json:"ip_types"`
+    Location int      `json:"location"`
+    Name     string   `json:"name"`
+    OS       int      `json:"os"`
+    Plan     int      `json:"plan"`
+    Project  int      `json:"project"`
+    Tags     []string `json:"tags"`
+    UserData string   `json:"user_data"`
+}
+
+const APIKey = "vpstest-api-key"
+const defaultPageSize = 15
+
+// New starts a fake API which accepts APIKey, it is closed when the test finishes
+func New(t interface{ Cleanup(func()) }) *Server {
+    s := &Server{
+        APIKey:   APIKey,
+        PageSize: defaultPageSize,
+        failures: make(map[string]*Failure),
+        nextID:   100,
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /projects", s.listProjects)
+    mux.HandleFunc("POST /projects", s.createProject)
+    mux.HandleFunc("GET /projects/{id}/servers", s.listServers)
+    mux.HandleFunc("POST /servers", s.createServer)
+    mux.HandleFunc("GET /servers/{id}", s.getServer)
+    mux.HandleFunc("DELETE /servers/{id}", s.deleteServer)
+
+    s.Server = httptest.NewServer(s.middleware(mux))
+    t.Cleanup(s.Close)
+
+    return s
+}
+
+// AddProject adds an existing project and returns its id
+func (s *Server) AddProject(name string) int {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    s.nextID++
+    s.projects = append(s.projects, Project{ID: s.nextID, Name: name})
+
+    return s.nextID
+}
+
+// AddServer adds an existing running server to a project and returns its id
+func (s *Server) AddServer(projectID int, name string, tags ...string) int {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    return s.addServer(VPS{Name: name, Project: projectID, Tags: tags})
+}
+
+// Fail responds to the next requests matching a method and path, e.g. "POST /servers", with a failure
+func (s *Server) Fail(route string, failure Failure) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    if failure.Times == 0 {
+        failure.Times = 1
+    }
+
+    s.failures[route] = &failure
+}
+
+// Projects returns every project
+func (s *Server) Projects() []Project {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    return append([]Project(nil), s.projects...)
+}
+
+// Requests returns the method and path of every request received, e.g. "GET /projects"
+func (s *Server) Requests() []string {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    return append([]string(nil), s.requests...)
+}
+
+// Servers returns every server which hasn't been deleted
+func (s *Server) Servers() []VPS {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    return append([]VPS(nil), s.servers...)
+}
+
+// addServer assigns an id and address to a server and stores it, the lock must be held
+func (s *Server) addServer(server VPS) int {
+    s.nextID++
+
+    server.Created = time.Now().UTC().Format(time.RFC3339)
+    server.ID = s.nextID
+    server.IPs = []IP{
+        {IP: fmt.Sprintf("fe80::%d", s.nextID), Primary: false},
+        {IP: fmt.Sprintf("203.0.113.%d", s.nextID%254+1), Primary: true},
+    }
+    server.Status = "running"
+    if server.Tags == nil {
+        server.Tags = make([]string, 0)
+    }
+
+    s.servers = append(s.servers, server)
+
+    return server.ID
+}
+
+// createProject handles POST /projects
+func (s *Server) createProject(response http.ResponseWriter, request *http.Request) {
+    var project Project
+    err := json.NewDecoder(request.Body).Decode(&project)
+    if err != nil || project.Name == "" {
+        writeError(response, http.StatusUnprocessableEntity, "The name field is required.")
+        return
+    }
+
+    s.mutex.Lock()
+    s.nextID++
+    project.ID = s.nextID
+    s.projects = append(s.projects, project)
+    s.mutex.Unlock()
+
+    writeJSON(response, http.StatusCreated, map[string]any{"data": project})
+}
+
+// createServer handles POST /servers
+func (s *Server) createServer(response http.ResponseWriter, request *http.Request) {
+    var payload createServer
+    err := json.NewDecoder(request.Body).Decode(&payload)
+    if err != nil || payload.Name == "" {
+        writeError(response, http.StatusUnprocessableEntity, "The name field is required.")
+        return
+    }
+
+    s.mutex.Lock()
+    if s.project(payload.Project) == nil {
+        s.mutex.Unlock()
+        writeError(response, http.StatusUnprocessableEntity, "The selected project is invalid.")
+        return
+    }
+
+    id := s.addServer(VPS{
+        Location: payload.Location,
+        Name:     payload.Name,
+        OS:       payload.OS,
+        Plan:     payload.Plan,
+        Project:  payload.Project,
+        Tags:     payload.Tags,
+        UserData: payload.UserData,
+    })
+    server := *s.server(id)
+    s.mutex.Unlock()
+
+    writeJSON(response, http.StatusCreated, map[string]any{"data": server})
+}
+
+// deleteServer handles DELETE /servers/{id}
+func (s *Server) deleteServer(response http.ResponseWriter, request *http.Request) {
+    id, _ := strconv.Atoi(request.PathValue("id"))
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    for i, server := range s.servers {
+        if server.ID == id {
+            s.servers = append(s.servers[:i], s.servers[i+1:]...)
+            writeJSON(response, http.StatusOK, map[string]any{"message": "Server deleted."})
+            return
+        }
+    }
+
+    writeError(response, http.StatusNotFound, "No query results for model [Server].")
+}
+
+// getServer handles GET /servers/{id}
+func (s *Server) getServer(response http.ResponseWriter, request *http.Request) {
+    id, _ := strconv.Atoi(request.PathValue("id"))
+
+    s.mutex.Lock()
+    server := s.server(id)
+    s.mutex.Unlock()
+
+    if server == nil {
+        writeError(response, http.StatusNotFound, "No query results for model [Server].")
+        return
+    }
+
+    writeJSON(response, http.StatusOK, map[string]any{"data": server})
+}
+
+// listProjects handles GET /projects with an optional filter[search]
+func (s *Server) listProjects(response http.ResponseWriter, request *http.Request) {
+    search := strings.ToLower(request.URL.Query().Get("filter[search]"))
+
+    s.mutex.Lock()
+    matches := make([]Project, 0)
+    for _, project := range s.projects {
+        if strings.Contains(strings.ToLower(project.Name), search) {
+            matches = append(matches, project)
+        }
+    }
+    s.mutex.Unlock()
+
+    writePage(response, request, matches, s.PageSize)
+}
+
+// listServers handles GET /projects/{id}/servers
+func (s *Server) listServers(response http.ResponseWriter, request *http.Request) {
+    id, _ := strconv.Atoi(request.PathValue("id"))
+
+    s.mutex.Lock()
+    if s.project(id) == nil {
+        s.mutex.Unlock()
+        writeError(response, http.StatusNotFound, "No query results for model [Project].")
+        return
+    }
+
+    servers := make([]VPS, 0)
+    for _, server := range s.servers {
+        if server.Project == id {
+            servers = append(servers, server)
+        }
+    }
+    s.mutex.Unlock()
+
+    writePage(response, request, servers, s.PageSize)
+}
+
+// middleware records requests, applies latency, checks authentication and injects failures
+func (s *Server) middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        route := request.Method + " " + request.URL.Path
+
+        s.mutex.Lock()
+        s.requests = append(s.requests, route)
+        latency := s.Latency
+        failure := s.failures[route]
+        if failure != nil {
+            failure.Times--
+            if failure.Times == 0 {
+                delete(s.failures, route)
+            }
+        }
+        s.mutex.Unlock()
+
+        time.Sleep(latency)
+
+        if request.Header.Get("Authorization") != "Bearer "+s.APIKey {
+            writeError(response, http.StatusUnauthorized, "Unauthenticated.")
+            return
+        }
+
+        if failure != nil {
+            for name, value := range failure.Headers {
+                response.Header().Set(name, value)
+            }
+            response.WriteHeader(failure.Status)
+            _, _ = response.Write([]byte(failure.Body))
+            return
+        }
+
+        next.ServeHTTP(response, request)
+    })
+}
+
+// project finds a project by id, the lock must be held
+func (s *Server) project(id int) *Project {
+    for i := range s.projects {
+        if s.projects[i].ID == id {
+            return &s.projects[i]
+        }
+    }
+
+    return nil
+}
+
+// server finds a server by id, the lock must be held
+func (s *Server) server(id int) *VPS {
+    for i := range s.servers {
+        if s.servers[i].ID == id {
+            return &s.servers[i]
+        }
+    }
+
+    return nil
+}
+
+// writeError writes an error in the same format as the API
+func writeError(response http.ResponseWriter, status int, message string) {
+    writeJSON(response, status, map[string]any{"message": message})
+}
+
+// writeJSON writes a value as json
+func writeJSON(response http.ResponseWriter, status int, value any) {
+    response.Header().Set("Content-Type", "application/json")
+    response.WriteHeader(status)
+    _ = json.NewEncoder(response).Encode(value)
+}
+
+// writePage writes a single page of results with links and metadata in the same format as the API
+func writePage[T any](response http.ResponseWriter, request *http.Request, items []T, size int) {
+    page, _ := strconv.Atoi(request.URL.Query().Get("page"))
+    page = max(page, 1)
+    size = max(size, 1)
+    last := max((len(items)+size-1)/size, 1)
+
+    start := min((page-1)*size, len(items))
+    end := min(start+size, len(items))
+
+    var next *string
+    if page < last {
+        query := request.URL.Query()
+        query.Set("page", strconv.Itoa(page+1))
+        link := fmt.Sprintf("http://%s%s?%s", request.Host, request.URL.Path, query.Encode())
+        next = &link
+    }
+
+    writeJSON(response, http.StatusOK, map[string]any{
+        "data":  items[start:end],
+        "links": map[string]any{"next": next},
+        "meta":  map[string]any{"current_page": page, "last_page": last, "per_page": size, "total": len(items)},
+    })
+}
@@ -0,0 +1,186 @@
+package wireguard
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "net/netip"
+    "os"
+    "path/filepath"
+    "slices"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+const allocationsFile = "peers.json"
+
+// AllocatePeers assigns the next free address within the interface address to each peer without allowed IPs.
+// Allocations are saved to the data path by public key so peers keep the same address when servers are recreated,
+// including peers which are temporarily removed or given explicit allowed IPs.
+func AllocatePeers(env env.Env) (env.Env, error) {
+    if !needsAllocation(env.Wireguard.Peers) {
+        return env, nil
+    }
+
+    interfacePrefix, err := netip.ParsePrefix(env.Wireguard.Interface.Address)
+    if err != nil || !interfacePrefix.Addr().Is4() {
+        return env, fmt.Errorf("unable to allocate peer addresses, WIREGUARD_ADDRESS '%s' is not a valid CIDR", env.Wireguard.Interface.Address)
+    }
+
+    path := filepath.Join(env.Data.Path, allocationsFile)
+
+    saved, err := readAllocations(path)
+    if err != nil {
+        return env, err
+    }
+
+    // Reserve the interface address and any addresses which have been set explicitly
+    explicitIPs := make(map[string]netip.Prefix)
+    used := []netip.Prefix{netip.PrefixFrom(interfacePrefix.Addr(), 32)}
+    for _, peer := range env.Wireguard.Peers {
+        if peer.AllowedIPs == "" {
+            continue
+        }
+
+        explicit, err := netip.ParsePrefix(peer.AllowedIPs)
+        if err == nil {
+            explicitIPs[peer.PublicKey] = explicit
+            used = append(used, explicit)
+        }
+    }
+
+    // Saved allocations are kept for peers which aren't being allocated this time so their address stays reserved,
+    // unless the address has since been set explicitly for another peer or is the interface address
+    allocations := make(map[string]string)
+    reserved := slices.Clone(used)
+    for publicKey, allowedIPs := range saved {
+        previous, err := netip.ParsePrefix(allowedIPs)
+        if err != nil || (overlaps(used, previous) && explicitIPs[publicKey] != previous) {
+            continue
+        }
+
+        allocations[publicKey] = allowedIPs
+        reserved = append(reserved, previous)
+    }
+
+    peers := slices.Clone(env.Wireguard.Peers)
+
+    // Peers with a saved allocation keep it as long as it's still within the interface address
+    for i, peer := range peers {
+        if peer.AllowedIPs != "" {
+            continue
+        }
+
+        previous, err := netip.ParsePrefix(allocations[peer.PublicKey])
+        if err == nil && interfacePrefix.Contains(previous.Addr()) {
+            peers[i].AllowedIPs = previous.String()
+        }
+    }
+
+    for i, peer := range peers {
+        if peer.AllowedIPs != "" {
+            continue
+        }
+
+        next, err := nextFreeAddress(interfacePrefix, reserved)
+        if err != nil {
+            return env, err
+        }
+
+        peers[i].AllowedIPs = next.String()
+        allocations[peer.PublicKey] = peers[i].AllowedIPs
+        reserved = append(reserved, next)
+    }
+
+    err = writeAllocations(path, allocations)
+    if err != nil {
+        return env, err
+    }
+
+    env.Wireguard.Peers = peers
+
+    return env, nil
+}
+
+// needsAllocation determines whether any peers don't have allowed IPs set
+func needsAllocation(peers []env.Peer) bool {
+    for _, peer := range peers {
+        if peer.AllowedIPs == "" {
+            return true
+        }
+    }
+
+    return false
+}
+
+// nextFreeAddress finds the first host address within an IPv4 prefix which hasn't been used
+func nextFreeAddress(prefix netip.Prefix, used []netip.Prefix) (netip.Prefix, error) {
+    network := prefix.Masked()
+    base := network.Addr().As4()
+    last := binary.BigEndian.Uint32(base[:]) | (1<<(32-network.Bits()) - 1)
+    binary.BigEndian.PutUint32(base[:], last)
+    broadcast := netip.AddrFrom4(base)
+
+    for addr := network.Addr().Next(); network.Contains(addr) && addr != broadcast; addr = addr.Next() {
+        candidate := netip.PrefixFrom(addr, 32)
+        if !overlaps(used, candidate) {
+            return candidate, nil
+        }
+    }
+
+    return netip.Prefix{}, fmt.Errorf("unable to allocate peer address, WIREGUARD_ADDRESS '%s' has no free addresses", prefix)
+}
+
+// overlaps determines whether a prefix overlaps any used prefix
+func overlaps(used []netip.Prefix, prefix netip.Prefix) bool {
+    for _, existing := range used {
+        if existing.Overlaps(prefix) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// readAllocations reads saved allocations, an allocations file which doesn't exist is treated as empty
+func readAllocations(path string) (map[string]string, error) {
+    allocations := make(map[string]string)
+
+    contents, err := os.ReadFile(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return allocations, nil
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("unable to read peer allocations from %s: %v", path, err)
+    }
+
+    err = json.Unmarshal(contents, &allocations)
+    if err != nil {
+        return nil, fmt.Errorf("unable to read peer allocations from %s: %v", path, err)
+    }
+
+    return allocations, nil
+}
+
+// writeAllocations saves allocations to the data path
+func writeAllocations(path string, allocations map[string]string) error {
+    contents, err := json.MarshalIndent(allocations, "", "  ")
+    if err != nil {
+        return fmt.Errorf("unable to marshal peer allocations: %v", err)
+    }
+
+    err = os.MkdirAll(filepath.Dir(path), 0700)
+    if err != nil {
+        return fmt.Errorf("unable to create data path %s: %v", filepath.Dir(path), err)
+    }
+
+    err = os.WriteFile(path, contents, 0600)
+    if err != nil {
+        return fmt.Errorf("unable to save peer allocations to %s: %v", path, err)
+    }
+
+    return nil
+}
@@ -0,0 +1,79 @@
+package wireguard
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "strconv"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/keys"
+)
+
+type ClientConfig struct {
+    Config string `json:"config"`
+    ID     int    `json:"id"`
+    Name   string `json:"name,omitempty"`
+
+    placeholder bool
+}
+
+const clientAllowedIPs = "0.0.0.0/0"
+const clientTemplate = `[Interface]
+Address = %s
+%sPrivateKey = %s
+
+[Peer]
+AllowedIPs = %s
+Endpoint = %s
+PersistentKeepalive = 25
+PublicKey = %s
+`
+const privateKeyPlaceholder = "<private key for this peer>"
+
+// ErrNoPrivateKey is returned when a QR code is requested for a peer without a private key, the configuration would be
+// rejected when it's scanned
+var ErrNoPrivateKey = errors.New("peer private key is not set")
+
+// ClientConfigs generates a wg0.conf for each peer which connects to the server at host
+func ClientConfigs(env env.Env, host string) ([]ClientConfig, error) {
+    publicKey, err := keys.Public(env.Wireguard.Interface.PrivateKey)
+    if err != nil {
+        return nil, fmt.Errorf("unable to derive server public key: %v", err)
+    }
+
+    allowedIPs := env.Wireguard.Client.AllowedIPs
+    if allowedIPs == "" {
+        allowedIPs = clientAllowedIPs
+    }
+
+    var dns string
+    if env.Wireguard.Client.DNS != "" {
+        dns = fmt.Sprintf("DNS = %s\n", env.Wireguard.Client.DNS)
+    }
+
+    // A random port can't be known in advance, so clients wouldn't be able to connect
+    port := ListenPort(env)
+    if port == 0 {
+        return nil, fmt.Errorf("unable to generate client configurations, WIREGUARD_LISTENPORT must be a fixed port")
+    }
+
+    endpoint := net.JoinHostPort(host, strconv.Itoa(port))
+
+    configs := make([]ClientConfig, 0, len(env.Wireguard.Peers))
+    for _, peer := range env.Wireguard.Peers {
+        privateKey := peer.PrivateKey
+        if privateKey == "" {
+            privateKey = privateKeyPlaceholder
+        }
+
+        configs = append(configs, ClientConfig{
+            Config:      fmt.Sprintf(clientTemplate, peer.AllowedIPs, dns, privateKey, allowedIPs, endpoint, publicKey),
+            ID:          peer.ID,
+            Name:        peer.Name,
+            placeholder: peer.PrivateKey == "",
+        })
+    }
+
+    return configs, nil
+}
@@ -0,0 +1,117 @@
+package wireguard
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+const handshakeCron = "* * * * * wg show wg0 latest-handshakes > /var/www%[1]s.tmp && mv /var/www%[1]s.tmp /var/www%[1]s\n"
+const handshakePort = 51821
+const handshakeService = `#!/sbin/openrc-run
+
+description="Reports WireGuard handshakes to peers"
+command="/usr/sbin/httpd"
+command_args="-f -p %d -h /var/www -u nobody"
+command_background=true
+pidfile="/run/${RC_SVCNAME}.pid"
+
+depend() {
+    need wireguard
+}
+`
+const handshakeTimeout = 5 * time.Second
+
+// EncodedHandshakeCron returns a base64 encoded crontab entry which saves the latest handshake for each peer to the
+// handshake path every minute
+func EncodedHandshakeCron(env env.Env) string {
+    return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(handshakeCron, HandshakePath(env))))
+}
+
+// EncodedHandshakeService returns a base64 encoded OpenRC service which serves handshakes on every address of the
+// server, so each server can be checked at its own address
+func EncodedHandshakeService() string {
+    return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(handshakeService, handshakePort)))
+}
+
+// HandshakeAddress returns the address a server with an ip reports handshakes on
+func HandshakeAddress(ip string) string {
+    return net.JoinHostPort(ip, strconv.Itoa(handshakePort))
+}
+
+// HandshakePath returns the path the server reports handshakes on, which is derived from the server private key so it
+// can't be guessed by peers
+func HandshakePath(env env.Env) string {
+    sum := sha256.Sum256([]byte("handshake:" + env.Wireguard.Interface.PrivateKey))
+
+    return "/" + hex.EncodeToString(sum[:16])
+}
+
+// LatestHandshake returns the most recent handshake reported at an address from any peer other than SERVER_MONITORPEER,
+// or the zero time if no other peer has connected
+func LatestHandshake(env env.Env, address string) (time.Time, error) {
+    client := &http.Client{Timeout: handshakeTimeout}
+    response, err := client.Get(fmt.Sprintf("http://%s%s", address, HandshakePath(env)))
+    if err != nil {
+        return time.Time{}, fmt.Errorf("unable to read handshakes from %s: %v", address, err)
+    }
+    defer func() {
+        _ = response.Body.Close()
+    }()
+
+    if response.StatusCode != http.StatusOK {
+        return time.Time{}, fmt.Errorf("unable to read handshakes from %s, invalid status: %s", address, response.Status)
+    }
+
+    // The monitoring peer keeps its own connection alive, so its handshakes don't show the server is in use
+    monitor := monitorPublicKey(env)
+
+    var latest time.Time
+    scanner := bufio.NewScanner(response.Body)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) != 2 || (monitor != "" && fields[0] == monitor) {
+            continue
+        }
+
+        seconds, err := strconv.ParseInt(fields[1], 10, 64)
+        if err != nil || seconds == 0 {
+            continue
+        }
+
+        handshake := time.Unix(seconds, 0)
+        if handshake.After(latest) {
+            latest = handshake
+        }
+    }
+
+    if scanner.Err() != nil {
+        return time.Time{}, fmt.Errorf("unable to read handshakes from %s: %v", address, scanner.Err())
+    }
+
+    return latest, nil
+}
+
+// monitorPublicKey returns the public key of SERVER_MONITORPEER, or an empty string if it isn't set
+func monitorPublicKey(env env.Env) string {
+    if env.Server.MonitorPeerAlpha == "" {
+        return ""
+    }
+
+    for _, peer := range env.Wireguard.Peers {
+        if peer.ID == env.Server.MonitorPeer {
+            return peer.PublicKey
+        }
+    }
+
+    return ""
+}
@@ -0,0 +1,88 @@
+package wireguard
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+)
+
+const (
+    monitorKey = "bW9uaXRvcm1vbml0b3Jtb25pdG9ybW9uaXRvcm1vbmk="
+    phoneKey   = "cGhvbmVwaG9uZXBob25lcGhvbmVwaG9uZXBob25lcGg="
+)
+
+func TestLatestHandshake(t *testing.T) {
+    phone := time.Unix(1700000000, 0)
+    monitor := phone.Add(time.Hour)
+
+    tests := []struct {
+        expected    time.Time
+        handshakes  string
+        monitorPeer string
+        name        string
+    }{
+        {expected: monitor, handshakes: handshakeLines(phone, monitor), name: "every peer"},
+        {expected: phone, handshakes: handshakeLines(phone, monitor), monitorPeer: "1", name: "monitor peer ignored"},
+        {handshakes: handshakeLines(time.Unix(0, 0), monitor), monitorPeer: "1", name: "only monitor peer connected"},
+        {handshakes: "", name: "no peers"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            e := testEnv()
+            e.Server.MonitorPeer = 1
+            e.Server.MonitorPeerAlpha = test.monitorPeer
+
+            server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+                if request.URL.Path != HandshakePath(e) {
+                    http.NotFound(response, request)
+                    return
+                }
+
+                _, _ = fmt.Fprint(response, test.handshakes)
+            }))
+            defer server.Close()
+
+            handshake, err := LatestHandshake(e, strings.TrimPrefix(server.URL, "http://"))
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            if !handshake.Equal(test.expected) {
+                t.Errorf("expected latest handshake %s, got %s", test.expected, handshake)
+            }
+        })
+    }
+}
+
+func TestLatestHandshakeFailure(t *testing.T) {
+    server := httptest.NewServer(http.NotFoundHandler())
+    defer server.Close()
+
+    _, err := LatestHandshake(testEnv(), strings.TrimPrefix(server.URL, "http://"))
+    if err == nil || !strings.Contains(err.Error(), "invalid status") {
+        t.Fatalf("expected invalid status error, got %v", err)
+    }
+}
+
+// handshakeLines formats handshakes the way wg show latest-handshakes does
+func handshakeLines(phone time.Time, monitor time.Time) string {
+    return fmt.Sprintf("%s\t%d\n%s\t%d\n", phoneKey, phone.Unix(), monitorKey, monitor.Unix())
+}
+
+// testEnv returns an environment with a phone as peer 0 and the monitoring host as peer 1
+func testEnv() env.Env {
+    var e env.Env
+    e.Wireguard.Interface.PrivateKey = "aGFuZHNoYWtlaGFuZHNoYWtlaGFuZHNoYWtlaGFuZGg="
+    e.Wireguard.Peers = []env.Peer{
+        {ID: 0, PublicKey: phoneKey},
+        {ID: 1, PublicKey: monitorKey},
+    }
+
+    return e
+}
@@ -0,0 +1,59 @@
+package wireguard
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/sjdaws/cloudserver-vpn/env"
+    "github.com/sjdaws/cloudserver-vpn/keys"
+)
+
+const privateKeyFile = "wireguard.key"
+
+// EnsurePrivateKey loads the server private key from the data path if one isn't configured, generating and
+// saving a new key if one hasn't been saved previously
+func EnsurePrivateKey(env env.Env) (env.Env, error) {
+    if env.Wireguard.Interface.PrivateKey != "" {
+        return env, nil
+    }
+
+    path := PrivateKeyPath(env)
+
+    contents, err := os.ReadFile(path)
+    if err == nil {
+        env.Wireguard.Interface.PrivateKey = strings.TrimSpace(string(contents))
+        return env, nil
+    }
+
+    if !errors.Is(err, fs.ErrNotExist) {
+        return env, fmt.Errorf("unable to read private key from %s: %v", path, err)
+    }
+
+    privateKey, err := keys.Generate()
+    if err != nil {
+        return env, err
+    }
+
+    err = os.MkdirAll(filepath.Dir(path), 0700)
+    if err != nil {
+        return env, fmt.Errorf("unable to create data path %s: %v", filepath.Dir(path), err)
+    }
+
+    err = os.WriteFile(path, []byte(privateKey+"\n"), 0600)
+    if err != nil {
+        return env, fmt.Errorf("unable to save private key to %s: %v", path, err)
+    }
+
+    env.Wireguard.Interface.PrivateKey = privateKey
+
+    return env, nil
+}
+
+// PrivateKeyPath returns the path the server private key is saved to when it isn't configured
+func PrivateKeyPath(env env.Env) string {
+    return filepath.Join(env.Data.Path, privateKeyFile)
+}
@@ -0,0 +1,46 @@
+package wireguard
+
+import (
+    "fmt"
+
+    "github.com/skip2/go-qrcode"
+)
+
+// PNG renders the client configuration as a QR code image
+func (c ClientConfig) PNG(size int) ([]byte, error) {
+    err := c.scannable()
+    if err != nil {
+        return nil, err
+    }
+
+    image, err := qrcode.Encode(c.Config, qrcode.Medium, size)
+    if err != nil {
+        return nil, fmt.Errorf("unable to generate qr code for peer %d: %v", c.ID, err)
+    }
+
+    return image, nil
+}
+
+// Terminal renders the client configuration as a QR code which can be printed to a terminal
+func (c ClientConfig) Terminal() (string, error) {
+    err := c.scannable()
+    if err != nil {
+        return "", err
+    }
+
+    code, err := qrcode.New(c.Config, qrcode.Medium)
+    if err != nil {
+        return "", fmt.Errorf("unable to generate qr code for peer %d: %v", c.ID, err)
+    }
+
+    return code.ToSmallString(false), nil
+}
+
+// scannable checks the client configuration can be imported by scanning it
+func (c ClientConfig) scannable() error {
+    if c.placeholder {
+        return fmt.Errorf("unable to generate qr code for peer %d, set WIREGUARD_PEER%d_PRIVATEKEY: %w", c.ID, c.ID, ErrNoPrivateKey)
+    }
+
+    return nil
+}
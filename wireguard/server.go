@@ -1,4 +1,4 @@
-package vps
+package wireguard
 
 import (
     "encoding/base64"
@@ -22,13 +22,9 @@ PublicKey = %s
 
 `
 
-func generateEncodedWireguardConfiguration(env env.Env) string {
-    port := env.Wireguard.Interface.ListenPort
-    if port == 0 && env.Wireguard.Interface.ListenPortAlpha != "0" {
-        port = listenPort
-    }
-
-    config := fmt.Sprintf(interfaceTemplate, env.Wireguard.Interface.Address, port, env.Wireguard.Interface.PrivateKey)
+// EncodedServerConfig generates a base64 encoded wg0.conf for the server
+func EncodedServerConfig(env env.Env) string {
+    config := fmt.Sprintf(interfaceTemplate, env.Wireguard.Interface.Address, ListenPort(env), env.Wireguard.Interface.PrivateKey)
 
     for _, peer := range env.Wireguard.Peers {
         config += fmt.Sprintf(peerTemplate, peer.AllowedIPs, peer.PublicKey)
@@ -36,3 +32,13 @@ func generateEncodedWireguardConfiguration(env env.Env) string {
 
     return base64.StdEncoding.EncodeToString([]byte(config))
 }
+
+// ListenPort returns the port WireGuard listens on
+func ListenPort(env env.Env) int {
+    port := env.Wireguard.Interface.ListenPort
+    if port == 0 && env.Wireguard.Interface.ListenPortAlpha != "0" {
+        port = listenPort
+    }
+
+    return port
+}